@@ -5,80 +5,164 @@ package chi
 import (
 	"fmt"
 	"net/http"
-	"strconv"
+	"net/url"
+	"regexp"
+	"strings"
 
 	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+
+	"github.com/benhoyt/go-routing/introspect"
+	"github.com/benhoyt/go-routing/widgets"
 )
 
+// chi stores path parameters in the request context, not as path values
+var handlers = widgets.New(widgets.ParamsFunc(chi.URLParam))
+
 var Serve http.Handler
 
 func init() {
 	r := chi.NewRouter()
-
-	r.Get("/", home)
-	r.Get("/contact", contact)
-	r.Get("/api/widgets", apiGetWidgets)
-	r.Post("/api/widgets", apiCreateWidget)
-	r.Post("/api/widgets/{slug}", apiUpdateWidget)
-	r.Post("/api/widgets/{slug}/parts", apiCreateWidgetPart)
-	r.Post("/api/widgets/{slug}/parts/{id:[0-9]+}/update", apiUpdateWidgetPart)
-	r.Post("/api/widgets/{slug}/parts/{id:[0-9]+}/delete", apiDeleteWidgetPart)
-	r.Get("/{slug}", widgetGet)
-	r.Get("/{slug}/admin", widgetAdmin)
-	r.Post("/{slug}/image", widgetImage)
-
+	r.Use(middleware.GetHead)
+	for _, route := range routes {
+		r.Method(route.method, route.pattern, route.handler)
+		patterns[route.name] = route.pattern
+	}
 	Serve = r
 }
 
-func home(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "home\n")
-}
-
-func contact(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "contact\n")
-}
-
-func apiGetWidgets(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "apiGetWidgets\n")
-}
-
-func apiCreateWidget(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "apiCreateWidget\n")
-}
-
-func apiUpdateWidget(w http.ResponseWriter, r *http.Request) {
-	slug := chi.URLParam(r, "slug")
-	fmt.Fprintf(w, "apiUpdateWidget %s\n", slug)
-}
-
-func apiCreateWidgetPart(w http.ResponseWriter, r *http.Request) {
-	slug := chi.URLParam(r, "slug")
-	fmt.Fprintf(w, "apiCreateWidgetPart %s\n", slug)
-}
-
-func apiUpdateWidgetPart(w http.ResponseWriter, r *http.Request) {
-	slug := chi.URLParam(r, "slug")
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	fmt.Fprintf(w, "apiUpdateWidgetPart %s %d\n", slug, id)
+var routes = []struct {
+	name    string
+	method  string
+	pattern string
+	handler http.HandlerFunc
+}{
+	{"home", "GET", "/", handlers.Home},
+	{"contact", "GET", "/contact", handlers.Contact},
+	{"getWidgets", "GET", "/api/widgets", handlers.GetWidgets},
+	{"createWidget", "POST", "/api/widgets", handlers.CreateWidget},
+	{"updateWidget", "POST", "/api/widgets/{slug}", handlers.UpdateWidget},
+	{"createWidgetPart", "POST", "/api/widgets/{slug}/parts", handlers.CreateWidgetPart},
+	{"updateWidgetPart", "POST", "/api/widgets/{slug}/parts/{id:[0-9]+}/update", handlers.UpdateWidgetPart},
+	{"deleteWidgetPart", "POST", "/api/widgets/{slug}/parts/{id:[0-9]+}/delete", handlers.DeleteWidgetPart},
+	{"widget", "GET", "/{slug}", handlers.Widget},
+	{"widgetAdmin", "GET", "/{slug}/admin", handlers.WidgetAdmin},
+	{"widgetImage", "POST", "/{slug}/image", handlers.WidgetImage},
 }
 
-func apiDeleteWidgetPart(w http.ResponseWriter, r *http.Request) {
-	slug := chi.URLParam(r, "slug")
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	fmt.Fprintf(w, "apiDeleteWidgetPart %s %d\n", slug, id)
+var patterns = make(map[string]string) // by route name
+
+// URL builds the URL path for the route with the given name, substituting
+// params, which are alternating parameter names and values, for the
+// "{name}" and "{name:regexp}" parameters in its pattern, and the value
+// of the "*" parameter for a trailing "*". The path is escaped the way
+// url.URL escapes a Path, as chi routes on the escaped path (RawPath)
+// when a request's path isn't escaped that way. It returns an error if
+// there's no such route, or if a parameter is missing or unknown, or its
+// value wouldn't be matched: "{name}" values must be non-empty, have no
+// slashes, and match the regexp if there is one, and the path mustn't
+// have "." or ".." segments, which clients remove.
+func URL(name string, params ...string) (string, error) {
+	pattern, ok := patterns[name]
+	if !ok {
+		return "", fmt.Errorf("chi: no route named %q", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("chi: route %q: odd number of params", name)
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+	used := make(map[string]bool, len(values))
+
+	var sb strings.Builder
+	for pattern != "" {
+		i := strings.IndexAny(pattern, "{*")
+		if i < 0 {
+			sb.WriteString(pattern)
+			break
+		}
+		sb.WriteString(pattern[:i])
+		if pattern[i] == '*' {
+			value, ok := values["*"]
+			if !ok {
+				return "", fmt.Errorf("chi: route %q: missing param %q", name, "*")
+			}
+			sb.WriteString(value) // a "*" is always last
+			used["*"] = true
+			break
+		}
+		end := closingBrace(pattern, i)
+		param, rexpat, _ := strings.Cut(pattern[i+1:end], ":")
+		pattern = pattern[end+1:]
+		value, ok := values[param]
+		if !ok {
+			return "", fmt.Errorf("chi: route %q: missing param %q", name, param)
+		}
+		if value == "" || strings.Contains(value, "/") || rexpat != "" && !matchParam(rexpat, value) {
+			return "", fmt.Errorf("chi: route %q: param %q value %q wouldn't be matched", name, param, value)
+		}
+		sb.WriteString(value)
+		used[param] = true
+	}
+	for i := 0; i < len(params); i += 2 {
+		if !used[params[i]] {
+			return "", fmt.Errorf("chi: route %q has no param %q", name, params[i])
+		}
+	}
+	path := sb.String()
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return "", fmt.Errorf("chi: route %q: path %q isn't clean", name, path)
+		}
+	}
+	return (&url.URL{Path: path}).EscapedPath(), nil
 }
 
-func widgetGet(w http.ResponseWriter, r *http.Request) {
-	slug := chi.URLParam(r, "slug")
-	fmt.Fprintf(w, "widget %s\n", slug)
+// closingBrace returns the index of the "}" that closes the "{" at
+// pattern[i], allowing for braces in a parameter's regexp, as chi does.
+func closingBrace(pattern string, i int) int {
+	depth := 0
+	for ; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	panic(fmt.Sprintf("chi: unclosed param in %q", pattern)) // chi would have panicked too
 }
 
-func widgetAdmin(w http.ResponseWriter, r *http.Request) {
-	slug := chi.URLParam(r, "slug")
-	fmt.Fprintf(w, "widgetAdmin %s\n", slug)
+// matchParam reports whether value matches a parameter's regexp,
+// anchored as chi anchors it.
+func matchParam(rexpat, value string) bool {
+	if rexpat[0] != '^' {
+		rexpat = "^" + rexpat
+	}
+	if rexpat[len(rexpat)-1] != '$' {
+		rexpat += "$"
+	}
+	return regexp.MustCompile(rexpat).MatchString(value)
 }
 
-func widgetImage(w http.ResponseWriter, r *http.Request) {
-	slug := chi.URLParam(r, "slug")
-	fmt.Fprintf(w, "widgetImage %s\n", slug)
+// Routes returns the routes registered with Serve, using chi.Walk.
+func Routes() []introspect.RouteInfo {
+	var routes []introspect.RouteInfo
+	walk := func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		routes = append(routes, introspect.RouteInfo{
+			Method:  method,
+			Pattern: route,
+			Handler: introspect.HandlerName(handler),
+		})
+		return nil
+	}
+	if err := chi.Walk(Serve.(chi.Routes), walk); err != nil {
+		panic(err) // walk never returns an error
+	}
+	return routes
 }
@@ -0,0 +1,212 @@
+// Compare how the routers respond to a generated set of edge-case requests
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+)
+
+// diffPatterns are the paths of the 11 routes every router handles (GET
+// and POST /api/widgets share one), with ":slug" and ":id" parameters.
+var diffPatterns = []string{
+	"/",
+	"/contact",
+	"/api/widgets",
+	"/api/widgets/:slug",
+	"/api/widgets/:slug/parts",
+	"/api/widgets/:slug/parts/:id/update",
+	"/api/widgets/:slug/parts/:id/delete",
+	"/:slug",
+	"/:slug/admin",
+	"/:slug/image",
+}
+
+// diffValues are substituted for each parameter in diffPatterns, one
+// parameter at a time, with the others set to diffDefaults.
+var diffValues = []string{
+	"foo", "bar-baz", "", ".", "..", "%2F", "a%2Fb", "%2e%2e", "a%20b",
+	"ünïcödé", "%C3%BC", "API", "0", "1", "007", "-1", "+1", "1.5", "1e3",
+	"9223372036854775807", "9223372036854775808", "99999999999999999999",
+}
+
+var diffDefaults = map[string]string{
+	"slug": "foo",
+	"id":   "1",
+}
+
+// diffExtraPaths are requests not generated from diffPatterns.
+var diffExtraPaths = []string{
+	"//",
+	"//contact",
+	"/contact//",
+	"/api//widgets",
+	"/api/widgets//parts",
+	"/./contact",
+	"/api/../contact",
+	"/api/widgets/foo/../bar",
+	"/CONTACT",
+	"/Api/Widgets",
+	"/contact%3Fx=1",
+	"/%63ontact",
+}
+
+var diffMethods = []string{"GET", "HEAD", "POST", "PUT", "OPTIONS"}
+
+// diffPaths returns the paths to test, generated from diffPatterns (and
+// each of them with a trailing slash), followed by diffExtraPaths.
+func diffPaths() []string {
+	var paths []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	for _, pattern := range diffPatterns {
+		segments := strings.Split(pattern, "/")
+		for i, segment := range segments {
+			if !strings.HasPrefix(segment, ":") {
+				continue
+			}
+			for _, value := range diffValues {
+				path := make([]string, len(segments))
+				for j, s := range segments {
+					switch {
+					case j == i:
+						path[j] = value
+					case strings.HasPrefix(s, ":"):
+						path[j] = diffDefaults[s[1:]]
+					default:
+						path[j] = s
+					}
+				}
+				add(strings.Join(path, "/"))
+				add(strings.Join(path, "/") + "/")
+			}
+		}
+		if !strings.Contains(pattern, ":") {
+			add(pattern)
+			add(pattern + "/")
+		}
+	}
+	for _, path := range diffExtraPaths {
+		add(path)
+	}
+	return paths
+}
+
+// diffRow is a request along with each router's response to it.
+type diffRow struct {
+	method    string
+	path      string
+	responses []string // in the same order as the router names
+}
+
+// differs reports whether any of the routers' responses differ.
+func (row diffRow) differs() bool {
+	for _, response := range row.responses[1:] {
+		if response != row.responses[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// diffRouters sends every combination of method and path to each of the
+// named routers, returning a row per request.
+func diffRouters(names []string, methods, paths []string) ([]diffRow, error) {
+	var rows []diffRow
+	for _, path := range paths {
+		for _, method := range methods {
+			row := diffRow{method: method, path: path}
+			for _, name := range names {
+				response, err := diffServe(routers[name], method, path)
+				if err != nil {
+					return nil, err
+				}
+				row.responses = append(row.responses, response)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// diffServe serves a single request with handler, summarizing the
+// response as its status code, followed by the body for 200 responses
+// or the Location for redirects. Error bodies aren't included, as the
+// routers word them differently.
+//
+// The request's URL is built from path directly, as a server does for a
+// request line, rather than parsed as a URL reference, which would take
+// "//contact" as a host.
+func diffServe(handler http.Handler, method, path string) (response string, err error) {
+	unescaped, err := url.PathUnescape(path)
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	request := &http.Request{
+		Method: method,
+		URL:    &url.URL{Path: unescaped, RawPath: path},
+		Header: make(http.Header),
+	}
+	recorder := httptest.NewRecorder()
+	defer func() {
+		if r := recover(); r != nil {
+			response = fmt.Sprintf("panic: %v", r)
+		}
+	}()
+	handler.ServeHTTP(recorder, request)
+
+	response = fmt.Sprint(recorder.Code)
+	switch {
+	case recorder.Code == http.StatusOK && method != "HEAD":
+		response += " " + strings.TrimSpace(recorder.Body.String())
+	case recorder.Code >= 300 && recorder.Code < 400:
+		response += " " + recorder.Header().Get("Location")
+	}
+	return response, nil
+}
+
+// runDiff implements the "diff" subcommand, which prints a table of the
+// requests the routers disagree on.
+func runDiff(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	all := flags.Bool("all", false, "print every request, not just those the routers disagree on")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: go-routing diff [-all]\n\n")
+		fmt.Fprintf(flags.Output(), "Print a table of edge-case requests the routers respond to differently.\n")
+	}
+	flags.Parse(args)
+
+	rows, err := diffRouters(routerNames, diffMethods, diffPaths())
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "METHOD\tPATH\t%s\n", strings.Join(routerNames, "\t"))
+	numDiffs := 0
+	for _, row := range rows {
+		if !row.differs() && !*all {
+			continue
+		}
+		if row.differs() {
+			numDiffs++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", row.method, row.path, strings.Join(row.responses, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "\n%d of %d requests had differing responses\n", numDiffs, len(rows))
+	return nil
+}
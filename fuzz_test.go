@@ -0,0 +1,170 @@
+// Fuzz the routers
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/benhoyt/go-routing/routertest"
+	"github.com/benhoyt/go-routing/widgets"
+)
+
+// fuzzServe fuzzes the named router with arbitrary methods and paths,
+// checking that it doesn't panic and responds with a sensible status.
+// The path is set on the request directly rather than parsed from a
+// URL, so the router sees paths net/http would never give it, too.
+func fuzzServe(f *testing.F, name string) {
+	for _, c := range routertest.Spec {
+		f.Add(c.Method, c.Path)
+	}
+	f.Add("GET", "")
+	f.Add("GET", "//")
+	f.Add("POST", "/api/widgets//parts/1/update")
+	router := routers[name]
+	f.Fuzz(func(t *testing.T, method, path string) {
+		request := &http.Request{
+			Method: method,
+			URL:    &url.URL{Path: path},
+			Header: make(http.Header),
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		switch recorder.Code {
+		case 200, 204, 404, 405:
+		default:
+			t.Fatalf("%s %q: unexpected status %d", method, path, recorder.Code)
+		}
+	})
+}
+
+func FuzzMatch(f *testing.F)     { fuzzServe(f, "match") }
+func FuzzReswitch(f *testing.F)  { fuzzServe(f, "reswitch") }
+func FuzzRetable(f *testing.F)   { fuzzServe(f, "retable") }
+func FuzzShiftpath(f *testing.F) { fuzzServe(f, "shiftpath") }
+func FuzzSplit(f *testing.F)     { fuzzServe(f, "split") }
+func FuzzTrie(f *testing.F)      { fuzzServe(f, "trie") }
+
+// fuzzMethods are the methods FuzzRouters chooses from. OPTIONS isn't
+// included, as only some of the routers answer it automatically.
+var fuzzMethods = []string{"GET", "HEAD", "POST", "PUT"}
+
+// referenceRouter is the router the others are compared against.
+const referenceRouter = "stdlib"
+
+// FuzzRouters checks that every router responds to a request with the
+// same status code as the reference router, for any path, apart from
+// the known divergences listed in fuzzDivergences.
+func FuzzRouters(f *testing.F) {
+	for _, c := range routertest.Spec {
+		for i, method := range fuzzMethods {
+			if method == c.Method {
+				f.Add(uint8(i), c.Path)
+			}
+		}
+	}
+	for _, p := range []string{
+		"", "contact", "//", "/./contact", "/api/../contact",
+		"/api/widgets/foo/parts/x/update", "/api/widgets/\n",
+	} {
+		f.Add(uint8(0), p)
+	}
+	f.Fuzz(func(t *testing.T, methodIndex uint8, p string) {
+		method := fuzzMethods[int(methodIndex)%len(fuzzMethods)]
+		for _, d := range fuzzDivergences {
+			if !d.applies(method, p) {
+				continue
+			}
+			for _, name := range routerNames {
+				statuses, ok := d.statuses[name]
+				if !ok {
+					statuses = d.statuses[""]
+				}
+				if got := fuzzStatus(routers[name], method, p); !slices.Contains(statuses, got) {
+					t.Errorf("%s %q: %s gave %d, want one of %v (%s)", method, p, name, got, statuses, d.name)
+				}
+			}
+			return
+		}
+		want := fuzzStatus(routers[referenceRouter], method, p)
+		for _, name := range routerNames {
+			got := fuzzStatus(routers[name], method, p)
+			if got != want {
+				t.Errorf("%s %q: %s gave %d, %s gave %d", method, p, name, got, referenceRouter, want)
+			}
+		}
+	})
+}
+
+// fuzzDivergences are the requests the routers are known to respond to
+// differently, with the statuses each router may respond with (the ""
+// entry is for the routers not listed).
+var fuzzDivergences = []struct {
+	name     string
+	applies  func(method, p string) bool
+	statuses map[string][]int
+}{
+	{
+		// http.ServeMux redirects a path that isn't clean to the clean
+		// one, and gorilla/mux does too, with a 301. The other routers
+		// route the path as is, and pat also redirects some of them.
+		name: "path isn't clean",
+		applies: func(method, p string) bool {
+			return isUncleanPath(p)
+		},
+		statuses: map[string][]int{
+			"stdlib":  {http.StatusTemporaryRedirect},
+			"gorilla": {http.StatusMovedPermanently},
+			"pat":     {200, http.StatusMovedPermanently, 404, 405},
+			"":        {200, 404, 405},
+		},
+	},
+	{
+		// Routers whose patterns only match digits for the ID respond
+		// 404, whatever the method. The others only check the ID in the
+		// handler, so respond 405 to any method but POST.
+		name:    "invalid part ID",
+		applies: hasInvalidID,
+		statuses: map[string][]int{
+			"stdlib": {405},
+			"pat":    {405},
+			"trie":   {405},
+			"":       {404},
+		},
+	},
+}
+
+// isUncleanPath reports whether p doesn't start with a slash, or is
+// changed by path.Clean other than by removing a trailing slash.
+func isUncleanPath(p string) bool {
+	clean := path.Clean(p)
+	return !strings.HasPrefix(p, "/") || p != clean && (p != clean+"/" || clean == "/")
+}
+
+// hasInvalidID reports whether p is a part update or delete path whose
+// ID isn't made up only of digits, requested with a method other than
+// POST (with POST, every router responds 404).
+func hasInvalidID(method, p string) bool {
+	parts := strings.Split(p, "/")
+	if method == "POST" || len(parts) != 7 || parts[1] != "api" || parts[2] != "widgets" ||
+		parts[3] == "" || parts[4] != "parts" || parts[6] != "update" && parts[6] != "delete" {
+		return false
+	}
+	return !widgets.IsID(parts[5])
+}
+
+func fuzzStatus(router http.Handler, method, path string) int {
+	request := &http.Request{
+		Method: method,
+		URL:    &url.URL{Path: path},
+		Header: make(http.Header),
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder.Code
+}
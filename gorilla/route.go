@@ -3,84 +3,69 @@
 package gorilla
 
 import (
-	"fmt"
 	"net/http"
-	"strconv"
+	"slices"
 
 	"github.com/gorilla/mux"
+
+	"github.com/benhoyt/go-routing/introspect"
+	"github.com/benhoyt/go-routing/widgets"
 )
 
+// gorilla/mux stores path parameters in the request context, not as path
+// values, so they have to be looked up with mux.Vars
+var handlers = widgets.New(widgets.ParamsFunc(func(r *http.Request, name string) string {
+	return mux.Vars(r)[name]
+}))
+
 var Serve http.Handler
 
 func init() {
 	r := mux.NewRouter()
 
-	r.HandleFunc("/", home).Methods("GET")
-	r.HandleFunc("/contact", contact).Methods("GET")
-	r.HandleFunc("/api/widgets", apiGetWidgets).Methods("GET")
-	r.HandleFunc("/api/widgets", apiCreateWidget).Methods("POST")
-	r.HandleFunc("/api/widgets/{slug}", apiUpdateWidget).Methods("POST")
-	r.HandleFunc("/api/widgets/{slug}/parts", apiCreateWidgetPart).Methods("POST")
-	r.HandleFunc("/api/widgets/{slug}/parts/{id:[0-9]+}/update", apiUpdateWidgetPart).Methods("POST")
-	r.HandleFunc("/api/widgets/{slug}/parts/{id:[0-9]+}/delete", apiDeleteWidgetPart).Methods("POST")
-	r.HandleFunc("/{slug}", widgetGet).Methods("GET")
-	r.HandleFunc("/{slug}/admin", widgetAdmin).Methods("GET")
-	r.HandleFunc("/{slug}/image", widgetImage).Methods("POST")
+	r.HandleFunc("/", handlers.Home).Methods("GET", "HEAD")
+	r.HandleFunc("/contact", handlers.Contact).Methods("GET", "HEAD")
+	r.HandleFunc("/api/widgets", handlers.GetWidgets).Methods("GET", "HEAD")
+	r.HandleFunc("/api/widgets", handlers.CreateWidget).Methods("POST")
+	r.HandleFunc("/api/widgets/{slug}", handlers.UpdateWidget).Methods("POST")
+	r.HandleFunc("/api/widgets/{slug}/parts", handlers.CreateWidgetPart).Methods("POST")
+	r.HandleFunc("/api/widgets/{slug}/parts/{id:[0-9]+}/update", handlers.UpdateWidgetPart).Methods("POST")
+	r.HandleFunc("/api/widgets/{slug}/parts/{id:[0-9]+}/delete", handlers.DeleteWidgetPart).Methods("POST")
+	r.HandleFunc("/{slug}", handlers.Widget).Methods("GET", "HEAD")
+	r.HandleFunc("/{slug}/admin", handlers.WidgetAdmin).Methods("GET", "HEAD")
+	r.HandleFunc("/{slug}/image", handlers.WidgetImage).Methods("POST")
 
 	Serve = r
 }
 
-func home(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "home\n")
-}
-
-func contact(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "contact\n")
-}
-
-func apiGetWidgets(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "apiGetWidgets\n")
-}
-
-func apiCreateWidget(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "apiCreateWidget\n")
-}
-
-func apiUpdateWidget(w http.ResponseWriter, r *http.Request) {
-	slug := mux.Vars(r)["slug"]
-	fmt.Fprintf(w, "apiUpdateWidget %s\n", slug)
-}
-
-func apiCreateWidgetPart(w http.ResponseWriter, r *http.Request) {
-	slug := mux.Vars(r)["slug"]
-	fmt.Fprintf(w, "apiCreateWidgetPart %s\n", slug)
-}
-
-func apiUpdateWidgetPart(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	slug := vars["slug"]
-	id, _ := strconv.Atoi(vars["id"])
-	fmt.Fprintf(w, "apiUpdateWidgetPart %s %d\n", slug, id)
-}
-
-func apiDeleteWidgetPart(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	slug := vars["slug"]
-	id, _ := strconv.Atoi(vars["id"])
-	fmt.Fprintf(w, "apiDeleteWidgetPart %s %d\n", slug, id)
-}
-
-func widgetGet(w http.ResponseWriter, r *http.Request) {
-	slug := mux.Vars(r)["slug"]
-	fmt.Fprintf(w, "widget %s\n", slug)
-}
-
-func widgetAdmin(w http.ResponseWriter, r *http.Request) {
-	slug := mux.Vars(r)["slug"]
-	fmt.Fprintf(w, "widgetAdmin %s\n", slug)
-}
-
-func widgetImage(w http.ResponseWriter, r *http.Request) {
-	slug := mux.Vars(r)["slug"]
-	fmt.Fprintf(w, "widgetImage %s\n", slug)
+// Routes returns the routes registered with Serve, using Router.Walk.
+// GET routes are also registered for HEAD, so that they answer HEAD
+// requests like the other routers, but these aren't listed separately.
+func Routes() []introspect.RouteInfo {
+	var routes []introspect.RouteInfo
+	walk := func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		pattern, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			if method == "HEAD" && slices.Contains(methods, "GET") {
+				continue
+			}
+			routes = append(routes, introspect.RouteInfo{
+				Method:  method,
+				Pattern: pattern,
+				Handler: introspect.HandlerName(route.GetHandler()),
+			})
+		}
+		return nil
+	}
+	if err := Serve.(*mux.Router).Walk(walk); err != nil {
+		panic(err) // every route has a path and methods
+	}
+	return routes
 }
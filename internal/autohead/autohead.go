@@ -0,0 +1,51 @@
+// Helper for answering HEAD requests with GET handlers
+
+package autohead
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Serve serves a HEAD request using h, which is normally the handler for
+// GET requests to the same path. The response body h writes is discarded,
+// and unless h sets a Content-Length header itself, one is added with the
+// length of the discarded body, so the headers match those of a GET.
+func Serve(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	hw := &writer{ResponseWriter: w}
+	h.ServeHTTP(hw, r)
+	hw.flush()
+}
+
+// writer is a ResponseWriter that counts and discards the body, and
+// holds back the header until the handler has finished.
+type writer struct {
+	http.ResponseWriter
+	status int
+	length int
+}
+
+func (w *writer) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.length += len(b)
+	return len(b), nil
+}
+
+func (w *writer) flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	header := w.ResponseWriter.Header()
+	if header.Get("Content-Length") == "" && w.length > 0 {
+		header.Set("Content-Length", strconv.Itoa(w.length))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
@@ -0,0 +1,59 @@
+// Helpers for wrapping handlers in middleware
+
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Wrap returns h wrapped in the middleware mw, with mw[0] outermost, so
+// that it sees each request first. It returns h itself if mw is empty.
+func Wrap(h http.Handler, mw []func(http.Handler) http.Handler) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// A Stack is a handler that serves requests with a handler wrapped in
+// the middleware added to the stack by Use. The routers that are plain
+// functions use one for their package-level Use and Serve, and retable
+// uses one for each Router created by NewRouter. It's safe to
+// call Use while the stack is serving requests: requests already being
+// served keep the middleware they started with.
+type Stack struct {
+	handler http.Handler
+	mu      sync.Mutex // held by Use, so concurrent calls don't lose middleware
+	mw      []func(http.Handler) http.Handler
+	wrapped atomic.Pointer[wrapped]
+}
+
+// wrapped holds the stack's wrapped handler, as atomic.Pointer needs a
+// pointer, and atomic.Value would panic if the middleware changed the
+// handler's concrete type.
+type wrapped struct {
+	http.Handler
+}
+
+// NewStack returns a stack that serves requests with h, until
+// middleware is added with Use.
+func NewStack(h http.Handler) *Stack {
+	s := &Stack{handler: h}
+	s.wrapped.Store(&wrapped{h})
+	return s
+}
+
+// Use adds the middleware mw to the stack, inside any added before, and
+// with mw[0] outermost.
+func (s *Stack) Use(mw ...func(http.Handler) http.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mw = append(s.mw, mw...)
+	s.wrapped.Store(&wrapped{Wrap(s.handler, s.mw)})
+}
+
+func (s *Stack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.wrapped.Load().ServeHTTP(w, r)
+}
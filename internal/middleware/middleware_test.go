@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// tag returns middleware that appends name to the X-Trace header, then
+// calls the next handler.
+func tag(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func trace(h http.Handler) string {
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	return strings.Join(recorder.Header()["X-Trace"], " ")
+}
+
+func TestStack(t *testing.T) {
+	s := NewStack(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Trace", "handler")
+	}))
+	if got := trace(s); got != "handler" {
+		t.Fatalf("no middleware: got %q", got)
+	}
+	s.Use(tag("a"), tag("b"))
+	s.Use(tag("c"))
+	if got, want := trace(s), "a b c handler"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// TestStackConcurrentUse checks (when run with -race) that middleware
+// can be added while the stack is serving requests.
+func TestStackConcurrentUse(t *testing.T) {
+	s := NewStack(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.Use(tag("x"))
+		}()
+		go func() {
+			defer wg.Done()
+			trace(s)
+		}()
+	}
+	wg.Wait()
+	if got, want := trace(s), "x x x x"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
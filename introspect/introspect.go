@@ -0,0 +1,31 @@
+// Route introspection for the routers that support it
+
+package introspect
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	Method  string
+	Pattern string // in the router's own pattern syntax
+	Handler string // see HandlerName
+}
+
+// HandlerName returns a name for handler: the name of its function if
+// it's an http.HandlerFunc, such as "widgets.(*Handlers).Home", or its
+// type otherwise.
+func HandlerName(handler http.Handler) string {
+	f, ok := handler.(http.HandlerFunc)
+	if !ok {
+		return fmt.Sprintf("%T", handler)
+	}
+	name := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+	name = name[strings.LastIndexByte(name, '/')+1:] // strip import path
+	return strings.TrimSuffix(name, "-fm")           // suffix for method values
+}
@@ -0,0 +1,120 @@
+// Check routers for routes that shadow or overlap each other
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/benhoyt/go-routing/lint"
+	"github.com/benhoyt/go-routing/match"
+	"github.com/benhoyt/go-routing/reswitch"
+	"github.com/benhoyt/go-routing/retable"
+	"github.com/benhoyt/go-routing/stdlib"
+)
+
+// linters has a function for each router whose routes can be checked,
+// which returns its routes in the form lint.Check takes, and how the
+// router chooses between them.
+var linters = map[string]func() ([]lint.Route, lint.Mode, error){
+	"match":    lintMatch,
+	"reswitch": lintReswitch,
+	"retable":  lintRetable,
+	"stdlib":   lintStdlib,
+}
+
+func lintMatch() ([]lint.Route, lint.Mode, error) {
+	var routes []lint.Route
+	for _, info := range match.Routes() {
+		routes = append(routes, lint.Route{Method: info.Method, Pattern: info.Pattern, Regex: lint.MatchRegex(info.Pattern)})
+	}
+	return routes, lint.FirstMatch, nil
+}
+
+func lintReswitch() ([]lint.Route, lint.Mode, error) {
+	var routes []lint.Route
+	for _, info := range reswitch.Routes() {
+		routes = append(routes, lint.Route{Method: info.Method, Pattern: info.Pattern, Regex: info.Pattern})
+	}
+	return routes, lint.FirstMatch, nil
+}
+
+func lintRetable() ([]lint.Route, lint.Mode, error) {
+	var routes []lint.Route
+	for _, info := range retable.Serve.Routes() {
+		routes = append(routes, lint.Route{Method: info.Method, Pattern: info.Pattern, Regex: info.Pattern})
+	}
+	if retable.Serve.Precedence {
+		return routes, lint.MostSpecific, nil
+	}
+	return routes, lint.FirstMatch, nil
+}
+
+func lintStdlib() ([]lint.Route, lint.Mode, error) {
+	var routes []lint.Route
+	for _, info := range stdlib.Routes() {
+		route, err := lint.ServeMuxRoute(info.Method + " " + info.Pattern)
+		if err != nil {
+			return nil, 0, err
+		}
+		routes = append(routes, route)
+	}
+	return routes, lint.MostSpecific, nil
+}
+
+// lintRouter checks the routes of the named router, returning an error
+// if the router can't be checked.
+func lintRouter(name string) ([]lint.Problem, error) {
+	linter := linters[name]
+	if linter == nil {
+		if routers[name] != nil {
+			return nil, fmt.Errorf("router %q can't be checked", name)
+		}
+		return nil, fmt.Errorf("unknown router %q", name)
+	}
+	routes, mode, err := linter()
+	if err != nil {
+		return nil, err
+	}
+	return lint.Check(routes, mode)
+}
+
+// runLint implements the "lint" subcommand, which reports unreachable
+// and ambiguous routes, and fails if it finds any.
+func runLint(args []string, stdout io.Writer) error {
+	var names []string
+	for name := range linters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: go-routing lint [router ...]\n\n")
+		fmt.Fprintf(flags.Output(), "Report unreachable and ambiguous routes in the given routers (default all),\n")
+		fmt.Fprintf(flags.Output(), "which are some of: %s\n", strings.Join(names, ", "))
+	}
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		names = flags.Args()
+	}
+
+	total := 0
+	for _, name := range names {
+		problems, err := lintRouter(name)
+		if err != nil {
+			return err
+		}
+		for _, problem := range problems {
+			fmt.Fprintf(stdout, "%s: %s\n", name, problem)
+		}
+		total += len(problems)
+	}
+	if total > 0 {
+		return fmt.Errorf("found %d problem(s)", total)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// Static checks for routes that shadow or overlap each other
+
+package lint
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Route is a route to check.
+type Route struct {
+	Method  string // "*" for a route that matches any method
+	Pattern string // in the router's own syntax, for reporting
+	Regex   string // unanchored regex matching the same paths as Pattern
+}
+
+func (r Route) String() string {
+	return r.Method + " " + r.Pattern
+}
+
+// Mode is how a router chooses between routes that match a request.
+type Mode int
+
+const (
+	// FirstMatch routers try routes in the order they were registered,
+	// as retable and reswitch do.
+	FirstMatch Mode = iota
+
+	// MostSpecific routers choose the route that matches the fewest
+	// paths, as http.ServeMux does, regardless of registration order.
+	MostSpecific
+)
+
+// Kind is a kind of problem.
+type Kind int
+
+const (
+	// Unreachable means every path the route matches is also matched by
+	// routes registered before it, so it never handles a request.
+	Unreachable Kind = iota
+
+	// Ambiguous means two routes match some of the same paths, but
+	// neither matches every path the other does, so neither is more
+	// specific (for MostSpecific routers, this includes two routes that
+	// match exactly the same paths). A FirstMatch router chooses by
+	// order, so reordering the routes would change which one handles
+	// those paths; http.ServeMux refuses to register such routes.
+	Ambiguous
+)
+
+// Problem is a problem found by Check.
+type Problem struct {
+	Kind  Kind
+	Route Route // the later of the two routes
+	Other Route // the earlier route it conflicts with
+	Path  string
+}
+
+func (p Problem) String() string {
+	switch p.Kind {
+	case Unreachable:
+		return fmt.Sprintf("%s is unreachable: routes before it match every path it does, such as %q (matched by %s)",
+			p.Route, p.Path, p.Other)
+	default:
+		return fmt.Sprintf("%s and %s are ambiguous: both match %q, and neither is more specific",
+			p.Other, p.Route, p.Path)
+	}
+}
+
+// maxStates is the most states Check explores when comparing two
+// routes, to bound the time it takes on pathological regexes.
+const maxStates = 10000
+
+// Check reports the routes that are unreachable (for FirstMatch
+// routers) and the pairs of routes that are ambiguous, with an example
+// path for each. Routes only conflict if their methods are the same or
+// one of them is "*". Word boundaries in regexes are assumed to match,
+// so Check may report problems that can't happen with such regexes.
+func Check(routes []Route, mode Mode) ([]Problem, error) {
+	machines := make([]*machine, len(routes))
+	regexes := make([]*regexp.Regexp, len(routes))
+	for i, route := range routes {
+		m, err := compile(route.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("lint: %s: %w", route, err)
+		}
+		machines[i] = m
+		regexes[i] = regexp.MustCompile("^(?:" + route.Regex + ")$")
+	}
+
+	var problems []Problem
+	for j, route := range routes {
+		if mode == FirstMatch {
+			problem, err := checkUnreachable(routes[:j], regexes[:j], route, machines[j])
+			if err != nil {
+				return nil, err
+			}
+			if problem != nil {
+				problems = append(problems, *problem)
+				continue // any overlaps are moot
+			}
+		}
+		for i, other := range routes[:j] {
+			if !compete(other.Method, route.Method) {
+				continue
+			}
+			c, err := compare(machines[i], machines[j])
+			if err != nil {
+				return nil, fmt.Errorf("lint: %s and %s: %w", other, route, err)
+			}
+			isDuplicate := c.both != nil && c.onlyA == nil && c.onlyB == nil
+			isAmbiguous := c.both != nil && c.onlyA != nil && c.onlyB != nil
+			if isAmbiguous || isDuplicate && mode == MostSpecific && other.Method == route.Method {
+				problems = append(problems, Problem{Ambiguous, route, other, *c.both})
+			}
+		}
+	}
+	return problems, nil
+}
+
+// checkUnreachable returns an Unreachable problem if every path route
+// matches is matched by one of the earlier routes whose method covers
+// route's, or nil if not.
+func checkUnreachable(earlier []Route, regexes []*regexp.Regexp, route Route, m *machine) (*Problem, error) {
+	var alternatives []string
+	var covering []int
+	for i, other := range earlier {
+		if other.Method == route.Method || other.Method == "*" {
+			alternatives = append(alternatives, "(?:"+other.Regex+")")
+			covering = append(covering, i)
+		}
+	}
+	if len(alternatives) == 0 {
+		return nil, nil
+	}
+	union, err := compile(strings.Join(alternatives, "|"))
+	if err != nil {
+		return nil, err
+	}
+	c, err := compare(union, m)
+	if err != nil {
+		return nil, fmt.Errorf("lint: %s: %w", route, err)
+	}
+	if c.both == nil || c.onlyB != nil {
+		return nil, nil
+	}
+	for _, i := range covering {
+		if regexes[i].MatchString(*c.both) {
+			return &Problem{Unreachable, route, earlier[i], *c.both}, nil
+		}
+	}
+	return nil, errors.New("lint: no earlier route matches example path") // can't happen
+}
+
+// compete reports whether routes with the given methods can both match
+// a request.
+func compete(a, b string) bool {
+	return a == b || a == "*" || b == "*"
+}
@@ -0,0 +1,160 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	route := func(method, regex string) Route {
+		return Route{Method: method, Pattern: regex, Regex: regex}
+	}
+	tests := []struct {
+		name   string
+		routes []Route
+		mode   Mode
+		want   []string
+	}{{
+		name: "specific before general",
+		routes: []Route{
+			route("GET", "/contact"),
+			route("GET", "/([^/]+)"),
+		},
+		want: nil,
+	}, {
+		name: "general shadows specific",
+		routes: []Route{
+			route("GET", "/([^/]+)"),
+			route("GET", "/contact"),
+		},
+		want: []string{`GET /contact is unreachable: routes before it match every path it does, such as "/contact" (matched by GET /([^/]+))`},
+	}, {
+		name: "different methods",
+		routes: []Route{
+			route("POST", "/([^/]+)"),
+			route("GET", "/contact"),
+		},
+		want: nil,
+	}, {
+		name: "any method",
+		routes: []Route{
+			route("*", "/files(/.*)?"),
+			route("GET", "/files/[0-9]+"),
+		},
+		want: []string{`GET /files/[0-9]+ is unreachable: routes before it match every path it does, such as "/files/0" (matched by * /files(/.*)?)`},
+	}, {
+		name: "shadowed by several routes",
+		routes: []Route{
+			route("GET", "/[a-m]"),
+			route("GET", "/[n-z]"),
+			route("GET", "/[a-z]"),
+		},
+		want: []string{`GET /[a-z] is unreachable: routes before it match every path it does, such as "/a" (matched by GET /[a-m])`},
+	}, {
+		name: "ambiguous",
+		routes: []Route{
+			route("GET", "/api/[^/]+"),
+			route("GET", "/[^/]+/admin"),
+		},
+		want: []string{`GET /api/[^/]+ and GET /[^/]+/admin are ambiguous: both match "/api/admin", and neither is more specific`},
+	}, {
+		name: "disjoint",
+		routes: []Route{
+			route("GET", "/[^/]+/parts"),
+			route("GET", "/[^/]+/image"),
+			route("GET", "/[^/]+/image/"),
+		},
+		want: nil,
+	}, {
+		name: "duplicate most specific",
+		mode: MostSpecific,
+		routes: []Route{
+			route("GET", "/a"),
+			route("GET", "/a"),
+		},
+		want: []string{`GET /a and GET /a are ambiguous: both match "/a", and neither is more specific`},
+	}, {
+		name: "general first most specific",
+		mode: MostSpecific,
+		routes: []Route{
+			route("GET", "/([^/]+)"),
+			route("GET", "/contact"),
+		},
+		want: nil,
+	}, {
+		name: "anchors",
+		routes: []Route{
+			route("GET", "^/a$"),
+			route("GET", "/a"),
+		},
+		want: []string{`GET /a is unreachable: routes before it match every path it does, such as "/a" (matched by GET ^/a$)`},
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems, err := Check(test.routes, test.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range problems {
+				got = append(got, p.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestCheckBadRegex(t *testing.T) {
+	_, err := Check([]Route{{Method: "GET", Pattern: "/(", Regex: "/("}}, FirstMatch)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestMatchRegex(t *testing.T) {
+	tests := []struct{ pattern, want string }{
+		{"/", "/"},
+		{"/+", "/[^/]*"},
+		{"/api/widgets/+/parts/+/update", "/api/widgets/[^/]*/parts/[^/]*/update"},
+		{"/a.b", `/a\.b`},
+		{"/files/...", "/files/.*"},
+		{"/+/files/...", "/[^/]*/files/.*"},
+	}
+	for _, test := range tests {
+		if got := MatchRegex(test.pattern); got != test.want {
+			t.Errorf("MatchRegex(%q) = %q, want %q", test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestServeMuxRoute(t *testing.T) {
+	tests := []struct {
+		pattern string
+		method  string
+		regex   string
+		err     string
+	}{
+		{"GET /{$}", "GET", "/", ""},
+		{"/", "*", "/.*", ""},
+		{"POST /api/widgets/{slug}/parts/{id}/update", "POST", "/api/widgets/[^/]+/parts/[^/]+/update", ""},
+		{"GET /static/", "GET", "/static/.*", ""},
+		{"GET /files/{path...}", "GET", "/files/.*", ""},
+		{"GET /a.b", "GET", `/a\.b`, ""},
+		{"GET example.com/", "", "", "host patterns"},
+		{"GET /a{x}", "", "", "bad wildcard"},
+	}
+	for _, test := range tests {
+		route, err := ServeMuxRoute(test.pattern)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ServeMuxRoute(%q): got error %v, want %q", test.pattern, err, test.err)
+			}
+			continue
+		}
+		if err != nil || route.Method != test.method || route.Regex != test.regex {
+			t.Errorf("ServeMuxRoute(%q) = %q %q, %v, want %q %q", test.pattern, route.Method, route.Regex, err, test.method, test.regex)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package lint
+
+import (
+	"errors"
+	"regexp/syntax"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// machine runs a compiled regex as an NFA against a whole path, one rune
+// at a time, so that two regexes can be run side by side to compare the
+// sets of paths they match.
+type machine struct {
+	prog *syntax.Prog
+}
+
+func compile(regex string) (*machine, error) {
+	re, err := syntax.Parse(regex, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		return nil, err
+	}
+	return &machine{prog}, nil
+}
+
+// closure returns the instructions reachable from pcs without consuming
+// a rune: those that consume one, and InstMatch if it's reachable. begin
+// and end report whether the position is the start or end of the path,
+// for ^ and $ (other empty-width assertions are assumed to hold).
+func (m *machine) closure(pcs []uint32, begin, end bool) []uint32 {
+	seen := make([]bool, len(m.prog.Inst))
+	stack := slices.Clone(pcs)
+	var out []uint32
+	for len(stack) > 0 {
+		pc := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[pc] {
+			continue
+		}
+		seen[pc] = true
+		inst := &m.prog.Inst[pc]
+		switch inst.Op {
+		case syntax.InstAlt, syntax.InstAltMatch:
+			stack = append(stack, inst.Out, inst.Arg)
+		case syntax.InstCapture, syntax.InstNop:
+			stack = append(stack, inst.Out)
+		case syntax.InstEmptyWidth:
+			op := syntax.EmptyOp(inst.Arg)
+			if op&(syntax.EmptyBeginLine|syntax.EmptyBeginText) != 0 && !begin ||
+				op&(syntax.EmptyEndLine|syntax.EmptyEndText) != 0 && !end {
+				continue
+			}
+			stack = append(stack, inst.Out)
+		case syntax.InstMatch, syntax.InstRune, syntax.InstRune1, syntax.InstRuneAny, syntax.InstRuneAnyNotNL:
+			out = append(out, pc)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// step returns the instructions that follow those in closed (a closure)
+// that consume r.
+func (m *machine) step(closed []uint32, r rune) []uint32 {
+	var next []uint32
+	for _, pc := range closed {
+		inst := &m.prog.Inst[pc]
+		var ok bool
+		switch inst.Op {
+		case syntax.InstRune, syntax.InstRune1:
+			ok = inst.MatchRune(r)
+		case syntax.InstRuneAny:
+			ok = true
+		case syntax.InstRuneAnyNotNL:
+			ok = r != '\n'
+		}
+		if ok {
+			next = append(next, inst.Out)
+		}
+	}
+	slices.Sort(next)
+	return slices.Compact(next)
+}
+
+// accepts reports whether the path read so far is a match, given the
+// instructions the machine is at.
+func (m *machine) accepts(pcs []uint32, begin bool) bool {
+	for _, pc := range m.closure(pcs, begin, true) {
+		if m.prog.Inst[pc].Op == syntax.InstMatch {
+			return true
+		}
+	}
+	return false
+}
+
+// comparison is the result of comparing two machines: an example of a
+// path matched by both, only by a, and only by b, or nil if there's no
+// such path.
+type comparison struct {
+	both, onlyA, onlyB *string
+}
+
+// compare runs a and b side by side over every path, breadth first so
+// that the examples are as short as possible, and returns the first
+// example of each kind of path it finds.
+func compare(a, b *machine) (comparison, error) {
+	type state struct {
+		a, b  []uint32
+		begin bool
+		path  string
+	}
+	key := func(s state) string {
+		var sb strings.Builder
+		for _, pc := range s.a {
+			sb.WriteString(strconv.Itoa(int(pc)))
+			sb.WriteByte(',')
+		}
+		sb.WriteByte('|')
+		for _, pc := range s.b {
+			sb.WriteString(strconv.Itoa(int(pc)))
+			sb.WriteByte(',')
+		}
+		if s.begin {
+			sb.WriteByte('^')
+		}
+		return sb.String()
+	}
+
+	classes := runeClasses(a.prog, b.prog)
+	var c comparison
+	start := state{[]uint32{uint32(a.prog.Start)}, []uint32{uint32(b.prog.Start)}, true, ""}
+	seen := map[string]bool{key(start): true}
+	queue := []state{start}
+	for len(queue) > 0 && (c.both == nil || c.onlyA == nil || c.onlyB == nil) {
+		s := queue[0]
+		queue = queue[1:]
+		inA, inB := a.accepts(s.a, s.begin), b.accepts(s.b, s.begin)
+		path := s.path
+		switch {
+		case inA && inB && c.both == nil:
+			c.both = &path
+		case inA && !inB && c.onlyA == nil:
+			c.onlyA = &path
+		case !inA && inB && c.onlyB == nil:
+			c.onlyB = &path
+		}
+
+		closedA, closedB := a.closure(s.a, s.begin, false), b.closure(s.b, s.begin, false)
+		for _, r := range classes {
+			next := state{a.step(closedA, r), b.step(closedB, r), false, s.path + string(r)}
+			if len(next.a) == 0 && len(next.b) == 0 {
+				continue
+			}
+			k := key(next)
+			if seen[k] {
+				continue
+			}
+			if len(seen) >= maxStates {
+				return comparison{}, errors.New("regexes too complex to compare")
+			}
+			seen[k] = true
+			queue = append(queue, next)
+		}
+	}
+	return c, nil
+}
+
+// runeClasses splits the runes into classes that every instruction in
+// the programs treats the same way, and returns a representative of
+// each, with the ones that look best in an example path first.
+func runeClasses(progs ...*syntax.Prog) []rune {
+	bounds := []rune{0, '\n', '\n' + 1, unicode.MaxRune + 1}
+	addRange := func(lo, hi rune) {
+		bounds = append(bounds, lo, hi+1)
+	}
+	for _, prog := range progs {
+		for _, inst := range prog.Inst {
+			if inst.Op != syntax.InstRune && inst.Op != syntax.InstRune1 {
+				continue
+			}
+			runes := inst.Rune
+			if len(runes) == 1 {
+				runes = []rune{runes[0], runes[0]}
+			}
+			for i := 0; i+1 < len(runes); i += 2 {
+				addRange(runes[i], runes[i+1])
+				if syntax.Flags(inst.Arg)&syntax.FoldCase == 0 {
+					continue
+				}
+				// Approximate: only split at the case variants of the
+				// range's ends
+				for _, r := range []rune{runes[i], runes[i+1]} {
+					for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+						addRange(f, f)
+					}
+				}
+			}
+		}
+	}
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+
+	var reps []rune
+	for i := 0; i+1 < len(bounds); i++ {
+		reps = append(reps, representative(bounds[i], bounds[i+1]-1))
+	}
+	slices.SortStableFunc(reps, func(x, y rune) int {
+		return niceness(x) - niceness(y)
+	})
+	return reps
+}
+
+// representative returns the nicest rune in the range lo to hi, for use
+// in example paths.
+func representative(lo, hi rune) rune {
+	for _, want := range [][2]rune{{'a', 'z'}, {'0', '9'}, {'A', 'Z'}, {'-', '.'}, {'_', '_'}, {'!', '~'}} {
+		r := max(lo, want[0])
+		if r <= hi && r <= want[1] {
+			return r
+		}
+	}
+	return lo
+}
+
+// niceness ranks runes by how readable they are in an example path
+// (lower is better), putting '/' early so that examples take the shape
+// of the patterns.
+func niceness(r rune) int {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return 0
+	case r == '/':
+		return 1
+	case r >= '0' && r <= '9':
+		return 2
+	case r >= 'A' && r <= 'Z':
+		return 3
+	case r > ' ' && r <= '~':
+		return 4
+	default:
+		return 5
+	}
+}
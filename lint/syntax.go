@@ -0,0 +1,62 @@
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MatchRegex converts a pattern for the match package, where '+' matches
+// a path segment (possibly empty) and a final "..." matches the rest of
+// the path, to a regex. The regex for "..." matches any rest, though
+// match only allows a clean one, so an example path Check gives for a
+// "..." route may be one match wouldn't route to it.
+func MatchRegex(pattern string) string {
+	pattern, isRest := strings.CutSuffix(pattern, "...")
+	parts := strings.Split(pattern, "+")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	regex := strings.Join(parts, "[^/]*")
+	if isRest {
+		regex += ".*"
+	}
+	return regex
+}
+
+// ServeMuxRoute converts an http.ServeMux pattern, such as
+// "GET /widgets/{slug}", to a Route. Patterns with a host aren't
+// supported.
+func ServeMuxRoute(pattern string) (Route, error) {
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = "*", pattern
+	}
+	path = strings.TrimLeft(path, " \t")
+	if !strings.HasPrefix(path, "/") {
+		return Route{}, fmt.Errorf("lint: pattern %q: host patterns aren't supported", pattern)
+	}
+
+	var sb strings.Builder
+	segments := strings.Split(path[1:], "/")
+	for i, segment := range segments {
+		sb.WriteString("/")
+		isLast := i == len(segments)-1
+		switch {
+		case segment == "{$}" && isLast:
+			// Matches the path with the trailing slash, and nothing else
+		case segment == "" && isLast:
+			// Trailing slash: matches any path with this prefix
+			sb.WriteString(".*")
+		case strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "...}") && isLast:
+			sb.WriteString(".*")
+		case strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}"):
+			sb.WriteString("[^/]+")
+		case strings.ContainsAny(segment, "{}"):
+			return Route{}, fmt.Errorf("lint: pattern %q: bad wildcard in segment %q", pattern, segment)
+		default:
+			sb.WriteString(regexp.QuoteMeta(segment))
+		}
+	}
+	return Route{Method: method, Pattern: path, Regex: sb.String()}, nil
+}
@@ -0,0 +1,192 @@
+// Load test the routers over real sockets and report their latency
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/benhoyt/go-routing/routertest"
+)
+
+// loadResult is the result of load testing a single router.
+type loadResult struct {
+	Router     string  `json:"router"`
+	Requests   int     `json:"requests"`
+	Errors     int     `json:"errors"` // failed requests or unexpected statuses
+	Throughput float64 `json:"requests_per_sec"`
+	P50        float64 `json:"p50_ms"`
+	P99        float64 `json:"p99_ms"`
+	P999       float64 `json:"p999_ms"`
+}
+
+// runLoad implements the "load" subcommand, which serves each router on
+// a loopback port in turn and sends it requests from concurrent clients,
+// reporting each router's throughput and latency percentiles.
+func runLoad(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("load", flag.ExitOnError)
+	concurrency := flags.Int("c", 16, "number of concurrent clients")
+	duration := flags.Duration("d", 5*time.Second, "how long to load test each router")
+	only := flags.String("routers", "", "comma-separated routers to test (default all)")
+	mix := flags.String("mix", "all", `requests to send: "all" requests in the conformance spec, or only "ok" ones`)
+	jsonOutput := flags.Bool("json", false, "print results as JSON rather than a table")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: go-routing load [flags]\n\n")
+		fmt.Fprintf(flags.Output(), "Load test each router over a loopback connection, cycling through the\n")
+		fmt.Fprintf(flags.Output(), "requests from the conformance spec used by TestRouters.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	names := routerNames
+	if *only != "" {
+		names = strings.Split(*only, ",")
+		for _, name := range names {
+			if routers[name] == nil {
+				return fmt.Errorf("unknown router %q", name)
+			}
+		}
+	}
+	if *concurrency <= 0 {
+		return fmt.Errorf("-c must be positive")
+	}
+	if *mix != "all" && *mix != "ok" {
+		return fmt.Errorf(`-mix must be "all" or "ok"`)
+	}
+	var cases []routertest.Case
+	for _, c := range routertest.Spec {
+		if *mix == "all" || c.Status == http.StatusOK {
+			cases = append(cases, c)
+		}
+	}
+
+	var results []loadResult
+	for _, name := range names {
+		result, err := loadRouter(name, routers[name], cases, *concurrency, *duration)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		results = append(results, result)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "ROUTER\tREQUESTS\tERRORS\tREQ/S\tP50 (ms)\tP99 (ms)\tP999 (ms)\t\n")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.0f\t%.3f\t%.3f\t%.3f\t\n",
+			r.Router, r.Requests, r.Errors, r.Throughput, r.P50, r.P99, r.P999)
+	}
+	return tw.Flush()
+}
+
+// loadRequestTimeout is how long a load test request can take before
+// it's abandoned and counted as an error, so that a router that hangs
+// can't stop the load test from finishing.
+const loadRequestTimeout = 10 * time.Second
+
+// loadRouter serves router on a loopback port and sends it the requests
+// in cases, round robin, from the given number of concurrent clients
+// until duration has elapsed.
+func loadRouter(name string, router http.Handler, cases []routertest.Case, concurrency int, duration time.Duration) (loadResult, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return loadResult{}, err
+	}
+	server := &http.Server{Handler: router}
+	go server.Serve(listener)
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{MaxIdleConnsPerHost: concurrency},
+		Timeout:   loadRequestTimeout,
+	}
+	defer client.CloseIdleConnections()
+	baseURL := "http://" + listener.Addr().String()
+
+	var wg sync.WaitGroup
+	latencies := make([][]time.Duration, concurrency)
+	errors := make([]int, concurrency)
+	start := time.Now()
+	deadline := start.Add(duration)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := i; time.Now().Before(deadline); j++ {
+				c := cases[j%len(cases)]
+				requestStart := time.Now()
+				ok := loadRequest(client, baseURL, c)
+				latencies[i] = append(latencies[i], time.Since(requestStart))
+				if !ok {
+					errors[i]++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	all := slices.Concat(latencies...)
+	slices.Sort(all)
+	result := loadResult{
+		Router:     name,
+		Requests:   len(all),
+		Throughput: float64(len(all)) / elapsed.Seconds(),
+		P50:        milliseconds(percentile(all, 50)),
+		P99:        milliseconds(percentile(all, 99)),
+		P999:       milliseconds(percentile(all, 99.9)),
+	}
+	for _, n := range errors {
+		result.Errors += n
+	}
+	return result, nil
+}
+
+// loadRequest sends the request in c, reporting whether it succeeded
+// with the expected status.
+func loadRequest(client *http.Client, baseURL string, c routertest.Case) bool {
+	request, err := http.NewRequest(c.Method, baseURL+c.Path, nil)
+	if err != nil {
+		return false
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return false
+	}
+	defer response.Body.Close()
+	// Read the whole body so the connection can be reused
+	if _, err := io.Copy(io.Discard, response.Body); err != nil {
+		return false
+	}
+	return response.StatusCode == c.Status
+}
+
+// percentile returns the p'th percentile of the sorted durations, using
+// the nearest-rank method, or 0 if there are none.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	// Subtract a little to allow for rounding errors, such as 99.9% of
+	// 1000 being slightly more than 999
+	rank := int(math.Ceil(p/100*float64(len(sorted)) - 1e-9))
+	return sorted[max(0, min(rank, len(sorted))-1)]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -1,23 +1,27 @@
 // Test various ways to do HTTP method+path routing in Go
 
-// Each router handles the 11 URLs below:
+// Each router handles the 11 URLs below (run "go-routing routes router"
+// to list the routes a router registers, for those that support it):
 //
-// GET  /										# home
-// GET  /contact								# contact
-// GET  /api/widgets							# apiGetWidgets
-// POST /api/widgets                           	# apiCreateWidget
-// POST /api/widgets/:slug                     	# apiUpdateWidget
-// POST /api/widgets/:slug/parts               	# apiCreateWidgetPart
-// POST /api/widgets/:slug/parts/:id/update    	# apiUpdateWidgetPart
-// POST /api/widgets/:slug/parts/:id/delete    	# apiDeleteWidgetPart
-// GET  /:slug									# widget
-// GET  /:slug/admin                         	# widgetAdmin
-// POST /:slug/image							# widgetImage
+// GET  /                                      # Home
+// GET  /contact                               # Contact
+// GET  /api/widgets                           # GetWidgets
+// POST /api/widgets                           # CreateWidget
+// POST /api/widgets/:slug                     # UpdateWidget
+// POST /api/widgets/:slug/parts               # CreateWidgetPart
+// POST /api/widgets/:slug/parts/:id/update    # UpdateWidgetPart
+// POST /api/widgets/:slug/parts/:id/delete    # DeleteWidgetPart
+// GET  /:slug                                 # Widget
+// GET  /:slug/admin                           # WidgetAdmin
+// POST /:slug/image                           # WidgetImage
 
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -33,21 +37,53 @@ import (
 	"github.com/benhoyt/go-routing/shiftpath"
 	"github.com/benhoyt/go-routing/split"
 	"github.com/benhoyt/go-routing/stdlib"
+	"github.com/benhoyt/go-routing/trie"
 )
 
-const port = 8080
-
 func main() {
-	if len(os.Args) < 2 || routers[os.Args[1]] == nil {
-		fmt.Fprintf(os.Stderr, "usage: go-routing router\n\n")
-		fmt.Fprintf(os.Stderr, "router is one of: %s\n", strings.Join(routerNames, ", "))
-		os.Exit(1)
+	if len(os.Args) >= 2 && commands[os.Args[1]] != nil {
+		if err := commands[os.Args[1]](os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var config serverConfig
+	checkEnv := config.addFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: go-routing [flags] router\n")
+		fmt.Fprintf(os.Stderr, "       go-routing diff [-all]\n")
+		fmt.Fprintf(os.Stderr, "       go-routing lint [router ...]\n")
+		fmt.Fprintf(os.Stderr, "       go-routing load [flags]\n")
+		fmt.Fprintf(os.Stderr, "       go-routing routes router\n\n")
+		fmt.Fprintf(os.Stderr, "router is one of: %s\n\n", strings.Join(routerNames, ", "))
+		fmt.Fprintf(os.Stderr, "flags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if err := checkEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
 	}
-	routerName := os.Args[1]
-	router := routers[routerName]
+	if flag.NArg() != 1 || routers[flag.Arg(0)] == nil {
+		flag.Usage()
+		os.Exit(2)
+	}
+	routerName := flag.Arg(0)
+
+	if err := serve(context.Background(), config, routerName, routers[routerName]); err != nil {
+		log.Fatal(err)
+	}
+}
 
-	fmt.Printf("listening on port %d using %s router\n", port, routerName)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), router))
+// commands are the subcommands, each of which is called with the rest of
+// the command line arguments.
+var commands = map[string]func(args []string, stdout io.Writer) error{
+	"diff":   runDiff,
+	"lint":   runLint,
+	"load":   runLoad,
+	"routes": runRoutes,
 }
 
 var routers = map[string]http.Handler{
@@ -56,10 +92,11 @@ var routers = map[string]http.Handler{
 	"match":     http.HandlerFunc(match.Serve),
 	"pat":       pat.Serve,
 	"reswitch":  http.HandlerFunc(reswitch.Serve),
-	"retable":   http.HandlerFunc(retable.Serve),
+	"retable":   retable.Serve,
 	"shiftpath": http.HandlerFunc(shiftpath.Serve),
 	"split":     http.HandlerFunc(split.Serve),
 	"stdlib":    stdlib.Serve, // nil if Go version <1.22
+	"trie":      trie.Serve,
 }
 
 var routerNames = func() []string {
@@ -4,105 +4,268 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"regexp"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/benhoyt/go-routing/lint"
+	"github.com/benhoyt/go-routing/routertest"
 )
 
+// partialAllow is the set of routers that don't list every method
+// registered for a path in the Allow header of a 405 response.
+var partialAllow = map[string]bool{
+	"chi":       true, // no Allow header
+	"gorilla":   true, // no Allow header
+	"reswitch":  true, // only the first matching route's method
+	"shiftpath": true, // only the first matching route's method
+}
+
 func TestRouters(t *testing.T) {
+	for _, name := range routerNames {
+		t.Run(name, func(t *testing.T) {
+			if partialAllow[name] {
+				routertest.RunCases(t, routers[name], routertest.IgnoreAllow(routertest.Spec))
+				return
+			}
+			routertest.Run(t, routers[name])
+		})
+	}
+}
+
+// TestRawPathValues checks that the routers that set path values on the
+// request they're given set the segments as they are in the path, as
+// http.ServeMux does, rather than parsed and formatted again.
+func TestRawPathValues(t *testing.T) {
+	for _, name := range []string{"match", "reswitch", "shiftpath", "split", "stdlib"} {
+		r := httptest.NewRequest("POST", "/api/widgets/foo/parts/007/update", nil)
+		routers[name].ServeHTTP(httptest.NewRecorder(), r)
+		if slug, id := r.PathValue("slug"), r.PathValue("id"); slug != "foo" || id != "007" {
+			t.Errorf("%s: got slug %q, id %q, want \"foo\", \"007\"", name, slug, id)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	cases := []routertest.Case{
+		{Method: "OPTIONS", Path: "/", Status: 204, Allow: "GET, HEAD, OPTIONS"},
+		{Method: "OPTIONS", Path: "/contact", Status: 204, Allow: "GET, HEAD, OPTIONS"},
+		{Method: "OPTIONS", Path: "/api/widgets", Status: 204, Allow: "GET, HEAD, OPTIONS, POST"},
+		{Method: "OPTIONS", Path: "/api/widgets/foo", Status: 204, Allow: "OPTIONS, POST"},
+		{Method: "OPTIONS", Path: "/api/widgets/foo/parts/1/update", Status: 204, Allow: "OPTIONS, POST"},
+		{Method: "OPTIONS", Path: "/foo/admin", Status: 204, Allow: "GET, HEAD, OPTIONS"},
+		{Method: "OPTIONS", Path: "/foo/image", Status: 204, Allow: "OPTIONS, POST"},
+		{Method: "OPTIONS", Path: "/foo/no", Status: 404},
+	}
+	for _, name := range []string{"match", "split"} {
+		t.Run(name, func(t *testing.T) {
+			routertest.RunCases(t, routers[name], cases)
+		})
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	// The method and handler of each route, ignoring the patterns, as
+	// each router has its own pattern syntax
+	want := []string{
+		"GET widgets.(*Handlers).Contact",
+		"GET widgets.(*Handlers).GetWidgets",
+		"GET widgets.(*Handlers).Home",
+		"GET widgets.(*Handlers).Widget",
+		"GET widgets.(*Handlers).WidgetAdmin",
+		"POST widgets.(*Handlers).CreateWidget",
+		"POST widgets.(*Handlers).CreateWidgetPart",
+		"POST widgets.(*Handlers).DeleteWidgetPart",
+		"POST widgets.(*Handlers).UpdateWidget",
+		"POST widgets.(*Handlers).UpdateWidgetPart",
+		"POST widgets.(*Handlers).WidgetImage",
+	}
+	for name, routes := range routeLists {
+		t.Run(name, func(t *testing.T) {
+			var got []string
+			for _, route := range routes() {
+				got = append(got, route.Method+" "+route.Handler)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, want) {
+				t.Fatalf("got routes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+func TestDiffPaths(t *testing.T) {
+	paths := diffPaths()
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if seen[path] {
+			t.Errorf("duplicate path %q", path)
+		}
+		seen[path] = true
+		if !strings.HasPrefix(path, "/") {
+			t.Errorf("path %q doesn't start with a slash", path)
+		}
+	}
+	for _, path := range []string{
+		"/",
+		"/contact/",
+		"/api/widgets/%2F/parts/1/update",
+		"/api/widgets/foo/parts/-1/delete/",
+		"//contact",
+	} {
+		if !seen[path] {
+			t.Errorf("path %q not generated", path)
+		}
+	}
+}
+
+func TestDiffServe(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "host=%q path=%s\n", r.Host, r.URL.EscapedPath())
+	})
 	tests := []struct {
 		method string
 		path   string
-		status int
-		body   string
+		want   string
 	}{
-		{"GET", "/", 200, "home\n"},
-		{"POST", "/", 405, ""},
-
-		{"GET", "/contact", 200, "contact\n"},
-		{"POST", "/contact", 405, ""},
-		{"GET", "/contact/", 404, ""},
-		{"GET", "/contact/no", 404, ""},
-
-		{"GET", "/api/widgets", 200, "apiGetWidgets\n"},
-		{"GET", "/api/widgets/", 404, ""},
-
-		{"POST", "/api/widgets", 200, "apiCreateWidget\n"},
-		{"POST", "/api/widgets/", 404, ""},
-
-		{"POST", "/api/widgets/foo", 200, "apiUpdateWidget foo\n"},
-		{"POST", "/api/widgets/bar-baz", 200, "apiUpdateWidget bar-baz\n"},
-		{"POST", "/api/widgets/foo/", 404, ""},
-		{"GET", "/api/widgets/foo", 405, ""},
-
-		{"POST", "/api/widgets/foo/parts", 200, "apiCreateWidgetPart foo\n"},
-		{"POST", "/api/widgets/bar-baz/parts", 200, "apiCreateWidgetPart bar-baz\n"},
-		{"POST", "/api/widgets/foo/parts/", 404, ""},
-		{"GET", "/api/widgets/foo/parts", 405, ""},
-		{"POST", "/api/widgets/foo/zarts", 404, ""},
-
-		{"POST", "/api/widgets/foo/parts/1/update", 200, "apiUpdateWidgetPart foo 1\n"},
-		{"POST", "/api/widgets/foo/parts/1/update/no", 404, ""},
-		{"POST", "/api/widgets/foo/parts/42/update", 200, "apiUpdateWidgetPart foo 42\n"},
-		{"POST", "/api/widgets/foo/parts/bar/update", 404, ""},
-		{"POST", "/api/widgets/bar-baz/parts/99/update", 200, "apiUpdateWidgetPart bar-baz 99\n"},
-		{"GET", "/api/widgets/foo/parts/1/update", 405, ""},
-
-		{"POST", "/api/widgets/foo/parts/1/delete", 200, "apiDeleteWidgetPart foo 1\n"},
-		{"POST", "/api/widgets/foo/parts/1/delete/no", 404, ""},
-		{"POST", "/api/widgets/foo/parts/42/delete", 200, "apiDeleteWidgetPart foo 42\n"},
-		{"POST", "/api/widgets/foo/parts/bar/delete", 404, ""},
-		{"POST", "/api/widgets/bar-baz/parts/99/delete", 200, "apiDeleteWidgetPart bar-baz 99\n"},
-		{"GET", "/api/widgets/foo/parts/1/delete", 405, ""},
-		{"POST", "/api/widgets/foo/parts/1/no", 404, ""},
-
-		{"GET", "/foo", 200, "widget foo\n"},
-		{"GET", "/bar-baz", 200, "widget bar-baz\n"},
-		{"GET", "/foo/", 404, ""},
-		{"POST", "/foo", 405, ""},
-
-		{"GET", "/foo/admin", 200, "widgetAdmin foo\n"},
-		{"GET", "/bar-baz/admin", 200, "widgetAdmin bar-baz\n"},
-		{"GET", "/foo/admin/", 404, ""},
-		{"GET", "/foo/admin/no", 404, ""},
-		{"POST", "/foo/admin", 405, ""},
-
-		{"POST", "/foo/image", 200, "widgetImage foo\n"},
-		{"POST", "/foo/image/no", 404, ""},
-		{"GET", "/foo/image", 405, ""},
-		{"POST", "/bar-baz/image", 200, "widgetImage bar-baz\n"},
-		{"POST", "/foo/image/", 404, ""},
-		{"GET", "/foo/image", 405, ""},
-		{"GET", "/foo/no", 404, ""},
+		// Not parsed as a host
+		{"GET", "//contact", `200 host="" path=//contact`},
+		{"GET", "/a%2Fb", `200 host="" path=/a%2Fb`},
+		{"GET", "/%63ontact", `200 host="" path=/%63ontact`},
+		{"HEAD", "/contact", "200"},
 	}
-	for _, name := range routerNames {
-		router := routers[name]
+	for _, test := range tests {
+		got, err := diffServe(echo, test.method, test.path)
+		if err != nil || got != test.want {
+			t.Errorf("%s %s: got %q, %v, want %q", test.method, test.path, got, err, test.want)
+		}
+	}
+	if got, err := diffServe(http.RedirectHandler("/x", 301), "GET", "/"); err != nil || got != "301 /x" {
+		t.Errorf("redirect: got %q, %v", got, err)
+	}
+	if _, err := diffServe(echo, "GET", "/%zz"); err == nil {
+		t.Errorf("invalid escape: got no error")
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	var out bytes.Buffer
+	if err := runDiff([]string{"-all"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	wantRows := len(diffMethods) * len(diffPaths())
+	// Heading, one line per request, blank line, summary
+	if len(lines) != wantRows+3 {
+		t.Fatalf("got %d lines, want %d", len(lines), wantRows+3)
+	}
+	if fields := strings.Fields(lines[0]); !slices.Equal(fields[2:], routerNames) {
+		t.Errorf("got heading %q, want router names %q", fields[2:], routerNames)
+	}
+	summary := fmt.Sprintf(" of %d requests had differing responses", wantRows)
+	if !strings.HasSuffix(lines[len(lines)-1], summary) {
+		t.Errorf("got summary %q, want suffix %q", lines[len(lines)-1], summary)
+	}
+	// Routers that clean the path disagree on a double slash
+	if !regexp.MustCompile(`(?m)^GET +//contact +.*301 /contact`).MatchString(out.String()) {
+		t.Errorf("no GET //contact row with a redirect")
+	}
+}
+
+func TestLint(t *testing.T) {
+	for name := range linters {
 		t.Run(name, func(t *testing.T) {
-			for _, test := range tests {
-				path := strings.ReplaceAll(test.path, "/", "_")
-				t.Run(test.method+path, func(t *testing.T) {
-					recorder := httptest.NewRecorder()
-					request, err := http.NewRequest(test.method, test.path, &bytes.Buffer{})
-					if err != nil {
-						t.Fatal(err)
-					}
-					router.ServeHTTP(recorder, request)
-					if recorder.Code != test.status {
-						t.Fatalf("expected status %d, got %d", test.status, recorder.Code)
-					}
-					if test.status == 200 {
-						body := recorder.Body.String()
-						if body != test.body {
-							t.Fatalf("expected body %q, got %q", test.body, body)
-						}
-					}
-				})
+			problems, err := lintRouter(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, problem := range problems {
+				t.Error(problem)
 			}
 		})
 	}
 }
 
+func TestStrict(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	// A canceled context makes serve shut down as soon as it's started
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	config := serverConfig{addr: "127.0.0.1:0", strict: true}
+
+	for _, name := range []string{"match", "reswitch", "chi"} {
+		logged.Reset()
+		if err := serve(ctx, config, name, routers[name]); err != nil {
+			t.Fatalf("%s: got error %v, want nil", name, err)
+		}
+		skipped := strings.Contains(logged.String(), "routes can't be checked")
+		if skipped != (linters[name] == nil) {
+			t.Errorf("%s: got log %q", name, logged.String())
+		}
+	}
+
+	linters["shadowed"] = func() ([]lint.Route, lint.Mode, error) {
+		return []lint.Route{
+			{Method: "GET", Pattern: "/+", Regex: lint.MatchRegex("/+")},
+			{Method: "GET", Pattern: "/contact", Regex: lint.MatchRegex("/contact")},
+		}, lint.FirstMatch, nil
+	}
+	t.Cleanup(func() { delete(linters, "shadowed") })
+	err := serve(ctx, config, "shadowed", routers["match"])
+	if err == nil || !strings.Contains(err.Error(), "strict mode: GET /contact is unreachable") {
+		t.Fatalf("got error %v, want strict mode error", err)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var durations []time.Duration
+	for i := 1; i <= 1000; i++ {
+		durations = append(durations, time.Duration(i))
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, 1},
+		{50, 500},
+		{99, 990},
+		{99.9, 999},
+		{100, 1000},
+	}
+	for _, test := range tests {
+		if got := percentile(durations, test.p); got != test.want {
+			t.Errorf("percentile(%g) = %d, want %d", test.p, got, test.want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile of no durations = %d, want 0", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	result, err := loadRouter("trie", routers["trie"], routertest.Spec, 4, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Requests == 0 || result.Errors != 0 {
+		t.Fatalf("got %d requests with %d errors, want some requests and no errors", result.Requests, result.Errors)
+	}
+	if !(result.P50 <= result.P99 && result.P99 <= result.P999) {
+		t.Fatalf("percentiles out of order: %+v", result)
+	}
+}
+
 func BenchmarkRouters(b *testing.B) {
 	method := "POST"
 	path := "/api/widgets/foo/parts/1/update"
@@ -120,6 +283,10 @@ func BenchmarkRouters(b *testing.B) {
 			router = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 		}
 		b.Run(name, func(b *testing.B) {
+			if max, ok := maxAllocs[name]; ok {
+				checkAllocs(b, router, method, path, max)
+			}
+			b.ReportAllocs()
 			for i := 0; i < b.N; i++ {
 				request, err := http.NewRequest(method, path, &bytes.Buffer{})
 				if err != nil {
@@ -131,10 +298,61 @@ func BenchmarkRouters(b *testing.B) {
 	}
 }
 
-type noopResponseWriter struct{}
+// maxAllocs is the most allocations BenchmarkRouters allows per request
+// for routers whose allocations we want to keep down, including the two
+// made by copyRequest.
+var maxAllocs = map[string]float64{
+	// Each of these allocations has to stay:
+	//   - two for copyRequest, the request and its URL;
+	//   - one for the handler's Fprintf;
+	//   - two for the map SetPathValue creates on a request that wasn't
+	//     routed by a ServeMux, and the map's first group of entries
+	//     (the request's own storage for path values is unexported).
+	// retable itself allocates nothing else: group values are sliced out
+	// of the path rather than found with regexp's submatch methods, which
+	// always allocate their result, the mounted API router is passed the
+	// route it was searched for rather than a copy of the request, and
+	// the strings joined for nested mounts are only built once.
+	"retable": 5,
+}
+
+// checkAllocs fails the benchmark if router makes more than max
+// allocations serving a request.
+func checkAllocs(b *testing.B, router http.Handler, method, path string, max float64) {
+	template, err := http.NewRequest(method, path, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	responseWriter := &noopResponseWriter{}
+	allocs := testing.AllocsPerRun(100, func() {
+		router.ServeHTTP(responseWriter, copyRequest(template))
+	})
+	if allocs > max {
+		b.Fatalf("%g allocs per request, want at most %g", allocs, max)
+	}
+}
+
+// copyRequest returns a shallow copy of template with its own URL, which
+// is cheaper than creating a new request each time (some routers modify
+// the request's URL or fields).
+func copyRequest(template *http.Request) *http.Request {
+	request := *template
+	u := *template.URL
+	request.URL = &u
+	return &request
+}
+
+// noopResponseWriter discards the response. Its header map is reused
+// between requests, so that 404 and 405 responses can set headers.
+type noopResponseWriter struct {
+	header http.Header
+}
 
 func (r *noopResponseWriter) Header() http.Header {
-	return nil
+	if r.header == nil {
+		r.header = make(http.Header)
+	}
+	return r.header
 }
 
 func (r *noopResponseWriter) Write(b []byte) (int, error) {
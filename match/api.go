@@ -0,0 +1,72 @@
+package match
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/benhoyt/go-routing/widgets"
+)
+
+// The handlers for the API routes
+var (
+	apiWidgets           = methods{"GET": handlers.GetWidgets, "POST": handlers.CreateWidget}
+	postUpdateWidget     = post(handlers.UpdateWidget)
+	postCreateWidgetPart = post(handlers.CreateWidgetPart)
+	postUpdateWidgetPart = post(handlers.UpdateWidgetPart)
+	postDeleteWidgetPart = post(handlers.DeleteWidgetPart)
+)
+
+// api is the router for the widget API, which routes mounts under /api.
+func api(r *http.Request, p string) http.Handler {
+	var h http.Handler
+	var slug string
+
+	switch {
+	case match(p, "/widgets"):
+		h = apiWidgets
+	case group(r, p, "/widgets/+", widget, &h, &slug):
+	default:
+		return nil
+	}
+	if slug != "" {
+		r.SetPathValue("slug", slug)
+	}
+	return h
+}
+
+// widget is the router for a single widget in the API, which api mounts
+// under /widgets/+, so its routes are relative to /api/widgets/:slug.
+func widget(r *http.Request, p string) http.Handler {
+	var h http.Handler
+	var id partID
+
+	switch {
+	case match(p, ""):
+		h = postUpdateWidget
+	case match(p, "/parts"):
+		h = postCreateWidgetPart
+	case match(p, "/parts/+/update", &id):
+		h = postUpdateWidgetPart
+	case match(p, "/parts/+/delete", &id):
+		h = postDeleteWidgetPart
+	default:
+		return nil
+	}
+	if id != "" {
+		r.SetPathValue("id", string(id))
+	}
+	return h
+}
+
+// partID is a part ID (see widgets.IsID) as it appears in the path, so
+// that handlers see the segment as is, as they would from http.ServeMux,
+// rather than a number formatted again ("007" rather than "7").
+type partID string
+
+func (id *partID) UnmarshalText(text []byte) error {
+	if !widgets.IsID(string(text)) {
+		return errors.New("invalid part ID")
+	}
+	*id = partID(text)
+	return nil
+}
@@ -3,54 +3,200 @@
 package match
 
 import (
-	"fmt"
 	"net/http"
-	"strconv"
+	"path"
+	"sort"
 	"strings"
+
+	"github.com/benhoyt/go-routing/internal/autohead"
+	"github.com/benhoyt/go-routing/internal/middleware"
+	"github.com/benhoyt/go-routing/introspect"
+	"github.com/benhoyt/go-routing/widgets"
 )
 
+var handlers = widgets.Default
+
+var stack = middleware.NewStack(http.HandlerFunc(dispatch))
+
+// Use adds middleware that wraps the routing and handling of every
+// request, with the first outermost.
+func Use(mw ...func(http.Handler) http.Handler) {
+	stack.Use(mw...)
+}
+
 func Serve(w http.ResponseWriter, r *http.Request) {
+	stack.ServeHTTP(w, r)
+}
+
+func dispatch(w http.ResponseWriter, r *http.Request) {
+	h := routes(r, r.URL.Path)
+	if h == nil {
+		http.NotFound(w, r)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+// The handlers for the routes, built once rather than for every request
+var (
+	getHome         = get(handlers.Home)
+	getContact      = get(handlers.Contact)
+	getWidget       = get(handlers.Widget)
+	getWidgetAdmin  = get(handlers.WidgetAdmin)
+	postWidgetImage = post(handlers.WidgetImage)
+)
+
+// A router returns the handler for path, having set any path values on
+// r, or nil if none of its routes match path. The API routes have their
+// own router, which is mounted under /api with group.
+type router func(r *http.Request, path string) http.Handler
+
+// routes is the top-level router.
+func routes(r *http.Request, p string) http.Handler {
 	var h http.Handler
 	var slug string
-	var id int
 
-	p := r.URL.Path
 	switch {
 	case match(p, "/"):
-		h = get(home)
+		h = getHome
 	case match(p, "/contact"):
-		h = get(contact)
-	case match(p, "/api/widgets") && r.Method == "GET":
-		h = get(apiGetWidgets)
-	case match(p, "/api/widgets"):
-		h = post(apiCreateWidget)
-	case match(p, "/api/widgets/+", &slug):
-		h = post(apiWidget{slug}.update)
-	case match(p, "/api/widgets/+/parts", &slug):
-		h = post(apiWidget{slug}.createPart)
-	case match(p, "/api/widgets/+/parts/+/update", &slug, &id):
-		h = post(apiWidgetPart{slug, id}.update)
-	case match(p, "/api/widgets/+/parts/+/delete", &slug, &id):
-		h = post(apiWidgetPart{slug, id}.delete)
+		h = getContact
+	case group(r, p, "/api", api, &h):
+		// If the API router doesn't have a route for p, it's a widget
+		// named "api", which one of the cases below handles
+	case mounted(p, &h):
+		// Before the widget routes, as their '+' wildcards would match
+		// the paths under a mount's prefix
 	case match(p, "/+", &slug):
-		h = get(widget{slug}.widget)
+		h = getWidget
 	case match(p, "/+/admin", &slug):
-		h = get(widget{slug}.admin)
+		h = getWidgetAdmin
 	case match(p, "/+/image", &slug):
-		h = post(widget{slug}.image)
+		h = postWidgetImage
 	default:
-		http.NotFound(w, r)
-		return
+		return nil
 	}
-	h.ServeHTTP(w, r)
+	// Make the parameters available to the handler via r.PathValue
+	if slug != "" {
+		r.SetPathValue("slug", slug)
+	}
+	return h
+}
+
+// routeList lists the routes in the switch statements of routes, api and
+// widget, with their full patterns, in the order they're tried, so that
+// they can be listed by Routes and checked with the lint package (mounts
+// are added at run time, so they aren't listed). TestRoutes checks that
+// it agrees with the switch statements.
+var routeList = []struct {
+	method  string
+	pattern string
+	handler http.HandlerFunc
+}{
+	{"GET", "/", handlers.Home},
+	{"GET", "/contact", handlers.Contact},
+	{"GET", "/api/widgets", handlers.GetWidgets},
+	{"POST", "/api/widgets", handlers.CreateWidget},
+	{"POST", "/api/widgets/+", handlers.UpdateWidget},
+	{"POST", "/api/widgets/+/parts", handlers.CreateWidgetPart},
+	{"POST", "/api/widgets/+/parts/+/update", handlers.UpdateWidgetPart},
+	{"POST", "/api/widgets/+/parts/+/delete", handlers.DeleteWidgetPart},
+	{"GET", "/+", handlers.Widget},
+	{"GET", "/+/admin", handlers.WidgetAdmin},
+	{"POST", "/+/image", handlers.WidgetImage},
+}
+
+// Routes returns the package's routes, in the order they're tried.
+func Routes() []introspect.RouteInfo {
+	var infos []introspect.RouteInfo
+	for _, route := range routeList {
+		infos = append(infos, introspect.RouteInfo{
+			Method:  route.method,
+			Pattern: route.pattern,
+			Handler: introspect.HandlerName(route.handler),
+		})
+	}
+	return infos
+}
+
+// group reports whether path is prefix, or starts with prefix followed
+// by a slash, and routes has a handler for the rest of the path, which
+// it assigns to h. The rest is passed to routes as is, so the prefix
+// itself is "" and a trailing slash is "/". Like a pattern, prefix may
+// contain '+' wildcards, which are assigned to vars. For middleware
+// that applies to the whole group, wrap h in the case body:
+//
+//	case group(r, p, "/api", api, &h):
+//		h = middleware.Wrap(h, apiMiddleware)
+func group(r *http.Request, path, prefix string, routes router, h *http.Handler, vars ...interface{}) bool {
+	rest, ok := matchPrefix(path, prefix, vars...)
+	if !ok || rest != "" && rest[0] != '/' {
+		return false
+	}
+	found := routes(r, rest)
+	if found == nil {
+		return false
+	}
+	*h = found
+	return true
+}
+
+var mounts []mount // handlers added by Mount
+
+type mount struct {
+	prefix  string
+	handler http.Handler // with prefix stripped, see Mount
+}
+
+// Mount registers h to handle requests whose path is prefix, or starts
+// with prefix followed by a slash, for any method. The mounts are tried
+// after the home, contact and API routes, but before the widget routes,
+// so a mount's prefix takes the place of any widget with that slug. h is
+// called with a shallow copy of the request with prefix removed from its
+// path (it's wrapped in http.StripPrefix). Mount isn't safe to call while
+// Serve is handling requests.
+func Mount(prefix string, h http.Handler) {
+	mounts = append(mounts, mount{prefix, http.StripPrefix(prefix, h)})
+}
+
+// mounted reports whether path is under the prefix of a mount, and if
+// so, assigns the handler of the first such mount to h.
+func mounted(path string, h *http.Handler) bool {
+	for _, m := range mounts {
+		rest, ok := strings.CutPrefix(path, m.prefix)
+		if ok && (rest == "" || rest[0] == '/') {
+			*h = m.handler
+			return true
+		}
+	}
+	return false
 }
 
 // match reports whether path matches the given pattern, which is a
 // path with '+' wildcards wherever you want to use a parameter. Path
 // parameters are assigned to the pointers in vars (len(vars) must be
-// the number of wildcards), which must be of type *string or *int.
+// the number of wildcards), and a segment that isn't valid for its
+// var's type doesn't match. See scan for the types supported.
+//
+// A pattern may also end with a "..." wildcard, which matches the rest
+// of the path, slashes included, so "/files/..." matches "/files/" and
+// "/files/a/b.txt" (but not "/files"). The rest is assigned to the last
+// var as is, including any trailing slash, but only if it's already
+// clean: a path with "." or ".." segments or a double slash in the rest
+// doesn't match, so the rest can't refer to anything outside the
+// prefix, and each file has one path.
 func match(path, pattern string, vars ...interface{}) bool {
+	rest, ok := matchPrefix(path, pattern, vars...)
+	return ok && rest == ""
+}
+
+// matchPrefix is like match, but pattern only needs to match the start
+// of path. It reports whether it did, and returns the rest of the path.
+func matchPrefix(path, pattern string, vars ...interface{}) (rest string, ok bool) {
 	for ; pattern != "" && path != ""; pattern = pattern[1:] {
+		if pattern == "..." {
+			break
+		}
 		switch pattern[0] {
 		case '+':
 			// '+' matches till next slash in path
@@ -60,101 +206,96 @@ func match(path, pattern string, vars ...interface{}) bool {
 			}
 			segment := path[:slash]
 			path = path[slash:]
-			switch p := vars[0].(type) {
-			case *string:
-				*p = segment
-			case *int:
-				n, err := strconv.Atoi(segment)
-				if err != nil || n < 0 {
-					return false
-				}
-				*p = n
-			default:
-				panic("vars must be *string or *int")
+			if !scan(segment, vars[0]) {
+				return "", false
 			}
 			vars = vars[1:]
 		case path[0]:
 			// non-'+' pattern byte must match path byte
 			path = path[1:]
 		default:
-			return false
+			return "", false
 		}
 	}
-	return path == "" && pattern == ""
-}
-
-func allowMethod(h http.HandlerFunc, method string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if method != r.Method {
-			w.Header().Set("Allow", method)
-			http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
-			return
+	if pattern == "..." {
+		// "..." matches the rest of the path, if it's clean
+		if !isCleanRest(path) || !scan(path, vars[0]) {
+			return "", false
 		}
-		h(w, r)
+		return "", true
 	}
+	return path, pattern == ""
 }
 
-func get(h http.HandlerFunc) http.HandlerFunc {
-	return allowMethod(h, "GET")
-}
-
-func post(h http.HandlerFunc) http.HandlerFunc {
-	return allowMethod(h, "POST")
-}
-
-func home(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "home\n")
-}
-
-func contact(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "contact\n")
-}
-
-func apiGetWidgets(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "apiGetWidgets\n")
-}
-
-func apiCreateWidget(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "apiCreateWidget\n")
-}
-
-type apiWidget struct {
-	slug string
-}
-
-func (h apiWidget) update(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "apiUpdateWidget %s\n", h.slug)
-}
-
-func (h apiWidget) createPart(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "apiCreateWidgetPart %s\n", h.slug)
-}
-
-type apiWidgetPart struct {
-	slug string
-	id   int
-}
-
-func (h apiWidgetPart) update(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "apiUpdateWidgetPart %s %d\n", h.slug, h.id)
+// isCleanRest reports whether rest, the part of a path matched by
+// "...", is unchanged by path.Clean (ignoring a trailing slash).
+func isCleanRest(rest string) bool {
+	if rest == "" {
+		return true
+	}
+	trimmed := strings.TrimSuffix(rest, "/")
+	return trimmed != "" && path.Clean("/"+trimmed) == "/"+trimmed
 }
 
-func (h apiWidgetPart) delete(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "apiDeleteWidgetPart %s %d\n", h.slug, h.id)
-}
+// methods is a handler that dispatches to the handler registered for
+// the request's method, with the GET handler also answering HEAD. If
+// there isn't one, it responds to OPTIONS with 204 No Content, and to
+// other methods with 405 Method Not Allowed, in both cases with an Allow
+// header listing every method allowed (OPTIONS included in the response
+// to OPTIONS). Build methods handlers once, in package variables, rather
+// than in a router, which would allocate one on every request.
+type methods map[string]http.HandlerFunc
 
-type widget struct {
-	slug string
+func (m methods) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h := m[r.Method]; h != nil {
+		h(w, r)
+		return
+	}
+	if r.Method == "HEAD" && m["GET"] != nil {
+		autohead.Serve(w, r, m["GET"])
+		return
+	}
+	allow := make([]string, 0, len(m)+2)
+	for method := range m {
+		allow = append(allow, method)
+		if method == "GET" && m["HEAD"] == nil {
+			allow = append(allow, "HEAD")
+		}
+	}
+	if r.Method == "OPTIONS" {
+		allow = append(allow, "OPTIONS")
+	}
+	sort.Strings(allow)
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
 }
 
-func (h widget) widget(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "widget %s\n", h.slug)
+// get returns a handler that only allows GET (and HEAD), wrapping h in
+// the middleware mw, with the first outermost. For example, to add
+// middleware to a single route in Serve:
+//
+//	var getWidgetAdmin = get(handlers.WidgetAdmin, requireAdmin)
+//
+// As the handler is only called once the route has matched, the
+// middleware can use r.PathValue.
+func get(h http.HandlerFunc, mw ...func(http.Handler) http.Handler) http.Handler {
+	return methods{"GET": with(h, mw)}
 }
 
-func (h widget) admin(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "widgetAdmin %s\n", h.slug)
+// post is like get, but only allows POST.
+func post(h http.HandlerFunc, mw ...func(http.Handler) http.Handler) http.Handler {
+	return methods{"POST": with(h, mw)}
 }
 
-func (h widget) image(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "widgetImage %s\n", h.slug)
+// with returns h wrapped in the middleware mw, for use in a methods
+// handler, for example methods{"POST": with(handlers.CreateWidget, mw)}.
+func with(h http.HandlerFunc, mw []func(http.Handler) http.Handler) http.HandlerFunc {
+	if len(mw) == 0 {
+		return h
+	}
+	return middleware.Wrap(h, mw).ServeHTTP
 }
@@ -0,0 +1,462 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benhoyt/go-routing/internal/middleware"
+	"github.com/benhoyt/go-routing/lint"
+	"github.com/benhoyt/go-routing/routertest"
+)
+
+// tag returns middleware that appends name to the X-Trace header, then
+// calls the next handler.
+func tag(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func serveTrace(h http.Handler, method, path string) (int, string) {
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+	return recorder.Code, strings.Join(recorder.Header()["X-Trace"], " ")
+}
+
+func TestUse(t *testing.T) {
+	t.Cleanup(func() { stack = middleware.NewStack(http.HandlerFunc(dispatch)) })
+	Use(tag("a"))
+	Use(tag("b"))
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"GET", "/foo", 200},
+		{"POST", "/foo", 405},
+		{"GET", "/foo/bar", 404},
+	}
+	for _, test := range tests {
+		status, trace := serveTrace(http.HandlerFunc(Serve), test.method, test.path)
+		if status != test.status || trace != "a b" {
+			t.Errorf("%s %s: got %d %q, want %d \"a b\"", test.method, test.path, status, trace, test.status)
+		}
+	}
+}
+
+func TestRouteMiddleware(t *testing.T) {
+	slug := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Trace", "slug="+r.PathValue("slug"))
+	}
+	route := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var slug string
+			if !match(r.URL.Path, "/+", &slug) {
+				http.NotFound(w, r)
+				return
+			}
+			r.SetPathValue("slug", slug)
+			h.ServeHTTP(w, r)
+		})
+	}
+	tests := []struct {
+		handler http.Handler
+		method  string
+		status  int
+		trace   string
+	}{
+		{get(slug), "GET", 200, "slug=foo"},
+		{get(slug, tag("a"), tag("b")), "GET", 200, "a b slug=foo"},
+		{get(slug, tag("a")), "HEAD", 200, "a slug=foo"},
+		{get(slug, tag("a")), "POST", 405, ""},
+		{post(slug, tag("a")), "POST", 200, "a slug=foo"},
+		{methods{"GET": slug, "POST": with(slug, []func(http.Handler) http.Handler{tag("a")})}, "GET", 200, "slug=foo"},
+		{methods{"GET": slug, "POST": with(slug, []func(http.Handler) http.Handler{tag("a")})}, "POST", 200, "a slug=foo"},
+	}
+	for i, test := range tests {
+		status, trace := serveTrace(route(test.handler), test.method, "/foo")
+		if status != test.status || trace != test.trace {
+			t.Errorf("%d: %s /foo: got %d %q, want %d %q", i, test.method, status, trace, test.status, test.trace)
+		}
+	}
+}
+
+func TestGroup(t *testing.T) {
+	var gotRest, gotSlug string
+	sub := func(r *http.Request, p string) http.Handler {
+		if p == "/missing" {
+			return nil
+		}
+		gotRest = p
+		return get(func(http.ResponseWriter, *http.Request) {})
+	}
+	tests := []struct {
+		path   string
+		prefix string
+		ok     bool
+		rest   string
+		slug   string
+	}{
+		{"/api", "/api", true, "", ""},
+		{"/api/", "/api", true, "/", ""},
+		{"/api/x/y", "/api", true, "/x/y", ""},
+		{"/apix", "/api", false, "", ""},
+		{"/ap", "/api", false, "", ""},
+		{"/api/missing", "/api", false, "", ""},
+		{"/w/foo/parts", "/w/+", true, "/parts", "foo"},
+		{"/w/foo", "/w/+", true, "", "foo"},
+	}
+	for _, test := range tests {
+		gotRest, gotSlug = "", ""
+		var h http.Handler
+		r := httptest.NewRequest("GET", test.path, nil)
+		ok := group(r, test.path, test.prefix, sub, &h, &gotSlug)
+		if ok != test.ok || ok && (h == nil || gotRest != test.rest || gotSlug != test.slug) {
+			t.Errorf("group(%q, %q): got %v rest %q slug %q, want %v rest %q slug %q",
+				test.path, test.prefix, ok, gotRest, gotSlug, test.ok, test.rest, test.slug)
+		}
+	}
+}
+
+func TestMount(t *testing.T) {
+	t.Cleanup(func() { mounts = nil })
+	Mount("/files", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Trace", "files path="+r.URL.Path)
+	}))
+	tests := []struct {
+		method string
+		path   string
+		status int
+		trace  string
+	}{
+		{"GET", "/files/a/b.txt", 200, "files path=/a/b.txt"},
+		{"DELETE", "/files/a", 200, "files path=/a"},
+		// The mount comes before the widget routes, which would
+		// otherwise match these
+		{"GET", "/files", 200, "files path="},
+		{"POST", "/files/image", 200, "files path=/image"},
+		{"GET", "/files/admin", 200, "files path=/admin"},
+		// But after the package's other routes
+		{"GET", "/contact", 200, ""},
+		{"GET", "/filesx", 200, ""},
+		{"GET", "/filesx/a", 404, ""},
+	}
+	for _, test := range tests {
+		status, trace := serveTrace(http.HandlerFunc(Serve), test.method, test.path)
+		if status != test.status || trace != test.trace {
+			t.Errorf("%s %s: got %d %q, want %d %q", test.method, test.path, status, trace, test.status, test.trace)
+		}
+	}
+}
+
+// TestRoutes checks that routeList agrees with the switch statements:
+// that it has the same routes in the same order, and that Serve routes
+// a path matching each route's pattern, with the route's method, to the
+// route's handler.
+func TestRoutes(t *testing.T) {
+	var listed []string
+	for _, route := range routeList {
+		listed = append(listed, route.method+" "+route.pattern)
+	}
+	if found := switchRoutes(t); !slices.Equal(listed, found) {
+		t.Fatalf("routeList has:\n%s\nswitch statements have:\n%s",
+			strings.Join(listed, "\n"), strings.Join(found, "\n"))
+	}
+
+	for _, route := range routeList {
+		path := strings.ReplaceAll(route.pattern, "+", "1")
+		recorder := httptest.NewRecorder()
+		Serve(recorder, httptest.NewRequest(route.method, path, nil))
+
+		want := httptest.NewRecorder()
+		r := httptest.NewRequest(route.method, path, nil)
+		r.SetPathValue("slug", "1")
+		r.SetPathValue("id", "1")
+		route.handler(want, r)
+
+		if recorder.Code != want.Code || recorder.Body.String() != want.Body.String() {
+			t.Errorf("%s %s: got %d %q, want %d %q", route.method, path,
+				recorder.Code, recorder.Body.String(), want.Code, want.Body.String())
+		}
+	}
+}
+
+// switchRoutes returns the routes in the switch statements, as "METHOD
+// pattern", in the order they're tried. They're found by parsing this
+// package's source: each case that calls match is a route, and each that
+// calls group adds the routes of the router it names, under its prefix.
+func switchRoutes(t *testing.T) []string {
+	fset := token.NewFileSet()
+	funcs := make(map[string]*ast.FuncDecl)
+	for _, filename := range []string{"route.go", "api.go"} {
+		f, err := parser.ParseFile(fset, filename, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok {
+				funcs[fn.Name.Name] = fn
+			}
+		}
+	}
+
+	var routes []string
+	var addRoutes func(router, prefix string)
+	addRoutes = func(router, prefix string) {
+		ast.Inspect(funcs[router], func(n ast.Node) bool {
+			clause, ok := n.(*ast.CaseClause)
+			if !ok || len(clause.List) == 0 {
+				return true
+			}
+			call, ok := clause.List[0].(*ast.CallExpr)
+			if !ok {
+				t.Fatalf("%s: case isn't a call", fset.Position(clause.Pos()))
+			}
+			switch name := call.Fun.(*ast.Ident).Name; name {
+			case "match":
+				pattern := prefix + stringLit(t, call.Args[1])
+				for _, method := range caseMethods(t, clause) {
+					routes = append(routes, method+" "+pattern)
+				}
+			case "group":
+				addRoutes(call.Args[3].(*ast.Ident).Name, prefix+stringLit(t, call.Args[2]))
+			case "mounted":
+				// Mounts are added by Mount at run time
+			default:
+				t.Fatalf("%s: unexpected call to %s", fset.Position(call.Pos()), name)
+			}
+			return false
+		})
+	}
+	addRoutes("routes", "")
+	return routes
+}
+
+func stringLit(t *testing.T, expr ast.Expr) string {
+	s, err := strconv.Unquote(expr.(*ast.BasicLit).Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// caseMethods returns the methods allowed by the handler a case assigns
+// to h: get(...), post(...), or methods{...}, or a variable set to one.
+func caseMethods(t *testing.T, clause *ast.CaseClause) []string {
+	rhs := clause.Body[0].(*ast.AssignStmt).Rhs[0]
+	if ident, ok := rhs.(*ast.Ident); ok && ident.Obj != nil {
+		// A handler built in a package variable
+		spec := ident.Obj.Decl.(*ast.ValueSpec)
+		for i, name := range spec.Names {
+			if name.Name == ident.Name {
+				rhs = spec.Values[i]
+			}
+		}
+	}
+	switch rhs := rhs.(type) {
+	case *ast.CallExpr:
+		return []string{strings.ToUpper(rhs.Fun.(*ast.Ident).Name)}
+	case *ast.CompositeLit:
+		var methods []string
+		for _, elt := range rhs.Elts {
+			methods = append(methods, stringLit(t, elt.(*ast.KeyValueExpr).Key))
+		}
+		return methods
+	}
+	t.Fatalf("unexpected handler %T", rhs)
+	return nil
+}
+
+// TestLint checks that none of the routes are unreachable or ambiguous.
+func TestLint(t *testing.T) {
+	var routes []lint.Route
+	for _, info := range Routes() {
+		routes = append(routes, lint.Route{Method: info.Method, Pattern: info.Pattern, Regex: lint.MatchRegex(info.Pattern)})
+	}
+	problems, err := lint.Check(routes, lint.FirstMatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range problems {
+		t.Error(problem)
+	}
+}
+
+// color is a custom type for TestScan's encoding.TextUnmarshaler test.
+type color string
+
+func (c *color) UnmarshalText(text []byte) error {
+	if len(text) != 6 || strings.Trim(string(text), "0123456789abcdef") != "" {
+		return errors.New("invalid color")
+	}
+	*c = color(text)
+	return nil
+}
+
+func TestScan(t *testing.T) {
+	var (
+		s      string
+		i      int
+		u      uint
+		i64    int64
+		b      bool
+		date   time.Time
+		id     UUID
+		c      color
+		action string
+	)
+	tests := []struct {
+		segment string
+		v       interface{}
+		ok      bool
+		want    interface{} // value of *v after a match
+	}{
+		{"foo", &s, true, "foo"},
+		{"", &s, true, ""},
+		{"42", &i, true, 42},
+		{"007", &i, true, 7},
+		{"-1", &i, false, nil},
+		{"+1", &i, false, nil},
+		{"1x", &i, false, nil},
+		{"", &i, false, nil},
+		{"99999999999999999999", &i, false, nil},
+		{"42", &u, true, uint(42)},
+		{"-1", &u, false, nil},
+		{"-42", &i64, true, int64(-42)},
+		{"9223372036854775807", &i64, true, int64(9223372036854775807)},
+		{"9223372036854775808", &i64, false, nil},
+		{"+1", &i64, false, nil},
+		{"-", &i64, false, nil},
+		{"true", &b, true, true},
+		{"false", &b, true, false},
+		{"1", &b, false, nil},
+		{"True", &b, false, nil},
+		{"2024-02-29", &date, true, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"2023-02-29", &date, false, nil},
+		{"2024-2-1", &date, false, nil},
+		{"123e4567-e89b-12d3-a456-426614174000", &id, true,
+			UUID{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}},
+		{"123E4567-E89B-12D3-A456-426614174000", &id, true,
+			UUID{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}},
+		{"123e4567e89b12d3a456426614174000", &id, false, nil},
+		{"123e4567-e89b-12d3-a456-42661417400g", &id, false, nil},
+		{"ff8800", &c, true, color("ff8800")},
+		{"orange", &c, false, nil},
+		{"update", enum(&action, "update", "delete"), true, "update"},
+		{"delete", enum(&action, "update", "delete"), true, "delete"},
+		{"patch", enum(&action, "update", "delete"), false, nil},
+	}
+	for _, test := range tests {
+		ok := scan(test.segment, test.v)
+		if ok != test.ok {
+			t.Errorf("scan(%q, %T): got %v, want %v", test.segment, test.v, ok, test.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		var got interface{}
+		switch v := test.v.(type) {
+		case enumVar:
+			got = *v.p
+		default:
+			got = reflect.ValueOf(v).Elem().Interface()
+		}
+		if got != test.want {
+			t.Errorf("scan(%q, %T): got %v, want %v", test.segment, test.v, got, test.want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("scan with *float64 didn't panic")
+		}
+	}()
+	scan("1", new(float64))
+}
+
+func TestMatchUUID(t *testing.T) {
+	var slug string
+	var id UUID
+	path := "/api/widgets/foo/parts/123e4567-e89b-12d3-a456-426614174000"
+	if !match(path, "/api/widgets/+/parts/+", &slug, &id) {
+		t.Fatalf("%q didn't match", path)
+	}
+	if slug != "foo" || id.String() != "123e4567-e89b-12d3-a456-426614174000" {
+		t.Errorf("got slug %q, id %s", slug, id)
+	}
+	if match("/api/widgets/foo/parts/1", "/api/widgets/+/parts/+", &slug, &id) {
+		t.Error("non-UUID part ID matched")
+	}
+}
+
+func TestCatchAll(t *testing.T) {
+	files := func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "files: %s\n", r.PathValue("rest"))
+	}
+	for _, prefix := range []string{"", "/api", "/api/v1"} {
+		t.Run("prefix="+prefix, func(t *testing.T) {
+			router := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var rest string
+				if !match(r.URL.Path, prefix+"/files/...", &rest) {
+					http.NotFound(w, r)
+					return
+				}
+				r.SetPathValue("rest", rest)
+				get(files).ServeHTTP(w, r)
+			})
+			routertest.RunCases(t, router, routertest.Prefix(prefix, routertest.CatchAllSpec))
+		})
+	}
+}
+
+func TestMatchRest(t *testing.T) {
+	tests := []struct {
+		path    string
+		pattern string
+		ok      bool
+		slug    string
+		rest    string
+	}{
+		{"/foo/files/a/b", "/+/files/...", true, "foo", "a/b"},
+		{"/foo/files/", "/+/files/...", true, "foo", ""},
+		{"/foo/files", "/+/files/...", false, "", ""},
+		{"/anything/at/all/", "/...", true, "", "anything/at/all/"},
+		{"/", "/...", true, "", ""},
+		{"", "/...", false, "", ""},
+	}
+	for _, test := range tests {
+		var slug, rest string
+		vars := []interface{}{&rest}
+		if strings.Contains(test.pattern, "+") {
+			vars = []interface{}{&slug, &rest}
+		}
+		ok := match(test.path, test.pattern, vars...)
+		if ok != test.ok || ok && (slug != test.slug || rest != test.rest) {
+			t.Errorf("match(%q, %q): got %v slug %q rest %q, want %v slug %q rest %q",
+				test.path, test.pattern, ok, slug, rest, test.ok, test.slug, test.rest)
+		}
+	}
+
+	var n int
+	if match("/n/a", "/n/...", &n) {
+		t.Error(`"/n/a" matched "/n/..." with an *int var`)
+	}
+	if !match("/n/42", "/n/...", &n) || n != 42 {
+		t.Errorf(`"/n/42": got %d, want 42`, n)
+	}
+}
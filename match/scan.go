@@ -0,0 +1,153 @@
+package match
+
+import (
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// scan parses a path segment into v, reporting whether the segment is
+// valid for v's type, which must be one of:
+//
+//   - *string: any segment, including an empty one
+//   - *int or *uint: decimal digits only, with no sign (IDs are never
+//     negative, so "-1" is a segment that doesn't match, not an ID)
+//   - *int64: decimal digits with an optional '-' sign
+//   - *bool: "true" or "false"
+//   - *time.Time: a date in the form 2006-01-02, at midnight UTC
+//   - *UUID, or any other encoding.TextUnmarshaler: whatever its
+//     UnmarshalText accepts
+//   - a var returned by enum: one of the enum's values
+//
+// Any other type panics, as that's a bug in the route.
+func scan(segment string, v interface{}) bool {
+	switch p := v.(type) {
+	case *string:
+		*p = segment
+	case *int:
+		if !isDigits(segment) {
+			return false
+		}
+		n, err := strconv.Atoi(segment)
+		if err != nil {
+			return false // out of range
+		}
+		*p = n
+	case *uint:
+		if !isDigits(segment) {
+			return false
+		}
+		n, err := strconv.ParseUint(segment, 10, 0)
+		if err != nil {
+			return false
+		}
+		*p = uint(n)
+	case *int64:
+		if digits, _ := cutByte(segment, '-'); !isDigits(digits) {
+			return false
+		}
+		n, err := strconv.ParseInt(segment, 10, 64)
+		if err != nil {
+			return false
+		}
+		*p = n
+	case *bool:
+		switch segment {
+		case "true":
+			*p = true
+		case "false":
+			*p = false
+		default:
+			return false
+		}
+	case *time.Time:
+		t, err := time.Parse(time.DateOnly, segment)
+		if err != nil {
+			return false
+		}
+		*p = t
+	case encoding.TextUnmarshaler:
+		return p.UnmarshalText([]byte(segment)) == nil
+	case enumVar:
+		if !slices.Contains(p.values, segment) {
+			return false
+		}
+		*p.p = segment
+	default:
+		panic(fmt.Sprintf("match: unsupported var type %T", v))
+	}
+	return true
+}
+
+// isDigits reports whether s is a non-empty string of ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// cutByte returns s without its first byte if that's b.
+func cutByte(s string, b byte) (string, bool) {
+	if s != "" && s[0] == b {
+		return s[1:], true
+	}
+	return s, false
+}
+
+type enumVar struct {
+	p      *string
+	values []string
+}
+
+// enum returns a var for match that only matches a segment that's one
+// of values, and assigns it to *p. For example, to match a part
+// action:
+//
+//	case match(p, "/parts/+/+", &id, enum(&action, "update", "delete")):
+func enum(p *string, values ...string) interface{} {
+	return enumVar{p, values}
+}
+
+// UUID is a UUID, for binding a path parameter in the canonical form
+// 123e4567-e89b-12d3-a456-426614174000 (upper-case hex digits are
+// accepted too).
+type UUID [16]byte
+
+// UnmarshalText parses a UUID in the canonical form.
+func (u *UUID) UnmarshalText(text []byte) error {
+	if len(text) != 36 || text[8] != '-' || text[13] != '-' || text[18] != '-' || text[23] != '-' {
+		return errors.New("match: invalid UUID")
+	}
+	var digits [32]byte
+	n := 0
+	for i, c := range text {
+		if i == 8 || i == 13 || i == 18 || i == 23 {
+			continue
+		}
+		digits[n] = c
+		n++
+	}
+	var parsed UUID
+	if _, err := hex.Decode(parsed[:], digits[:]); err != nil {
+		return errors.New("match: invalid UUID")
+	}
+	*u = parsed
+	return nil
+}
+
+// String returns the UUID in the canonical form, with lower-case hex
+// digits.
+func (u UUID) String() string {
+	s := hex.EncodeToString(u[:])
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
@@ -0,0 +1,150 @@
+// Benchmark the routers serving requests from parallel goroutines
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"text/tabwriter"
+)
+
+var (
+	parallelProcs = flag.String("procs", "1,2,4,8",
+		"comma-separated GOMAXPROCS values for BenchmarkRoutersParallel")
+	minScaling = flag.Float64("minscaling", 0.5,
+		"BenchmarkRoutersParallel flags routers whose speedup per proc is below this")
+)
+
+// BenchmarkRoutersParallel serves the same request as BenchmarkRouters
+// from parallel goroutines, at each GOMAXPROCS value given by the -procs
+// flag. It then logs a summary of each router's throughput, flagging
+// those whose speedup from 1 proc to the most procs (up to the number of
+// CPUs) is less than -minscaling times the number of procs.
+//
+// Run it with -v to see the summary, and with -benchtime set to a fixed
+// number of iterations (such as -benchtime 100000x) so that every router
+// does the same amount of work.
+func BenchmarkRoutersParallel(b *testing.B) {
+	var procs []int
+	for _, s := range strings.Split(*parallelProcs, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n <= 0 {
+			b.Fatalf("invalid -procs value %q", s)
+		}
+		procs = append(procs, n)
+	}
+	template, err := http.NewRequest("POST", "/api/widgets/foo/parts/1/update", nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	throughput := make(map[string]map[int]float64) // req/s by router and procs
+	for _, name := range routerNames {
+		router := routers[name]
+		for _, n := range procs {
+			runtime.GOMAXPROCS(n)
+			b.Run(fmt.Sprintf("%s/procs=%d", name, n), func(b *testing.B) {
+				b.ReportAllocs()
+				b.RunParallel(func(pb *testing.PB) {
+					responseWriter := &noopResponseWriter{}
+					for pb.Next() {
+						router.ServeHTTP(responseWriter, copyRequest(template))
+					}
+				})
+				// The last run has the largest b.N, so it overwrites the others
+				if throughput[name] == nil {
+					throughput[name] = make(map[int]float64)
+				}
+				throughput[name][n] = float64(b.N) / b.Elapsed().Seconds()
+			})
+		}
+	}
+
+	b.Log("\n" + scalingSummary(throughput, procs, runtime.NumCPU()))
+}
+
+// scalingSummary formats a table of each router's throughput at each
+// number of procs, and its speedup relative to 1 proc at the most procs
+// that can actually run in parallel (no more than numCPU).
+func scalingSummary(throughput map[string]map[int]float64, procs []int, numCPU int) string {
+	hasBase := slices.Contains(procs, 1)
+	maxProcs := 0
+	for _, n := range procs {
+		if n <= numCPU && n > maxProcs {
+			maxProcs = n
+		}
+	}
+
+	var sb strings.Builder
+	tw := tabwriter.NewWriter(&sb, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "router\t")
+	for _, n := range procs {
+		fmt.Fprintf(tw, "procs=%d\t", n)
+	}
+	fmt.Fprint(tw, "speedup\t\n")
+	var flagged []string
+	for _, name := range routerNames {
+		if throughput[name] == nil {
+			continue // filtered out by -bench
+		}
+		fmt.Fprintf(tw, "%s\t", name)
+		for _, n := range procs {
+			fmt.Fprintf(tw, "%.0f\t", throughput[name][n])
+		}
+		base, top := throughput[name][1], throughput[name][maxProcs]
+		if !hasBase || base == 0 || top == 0 || maxProcs <= 1 {
+			fmt.Fprint(tw, "-\t\n")
+			continue
+		}
+		speedup := top / base
+		fmt.Fprintf(tw, "%.2fx\t\n", speedup)
+		if speedup < *minScaling*float64(maxProcs) {
+			flagged = append(flagged, name)
+		}
+	}
+	tw.Flush()
+
+	switch {
+	case !hasBase:
+		fmt.Fprintf(&sb, "can't measure scaling: no baseline, as -procs doesn't include 1\n")
+	case maxProcs <= 1:
+		fmt.Fprintf(&sb, "can't measure scaling: need results for 1 proc and more than 1 proc (with %d CPUs)\n", numCPU)
+	case len(flagged) > 0:
+		fmt.Fprintf(&sb, "don't scale (speedup below %.2fx at procs=%d): %s\n",
+			*minScaling*float64(maxProcs), maxProcs, strings.Join(flagged, ", "))
+	default:
+		fmt.Fprintf(&sb, "all routers scale (speedup at least %.2fx at procs=%d)\n",
+			*minScaling*float64(maxProcs), maxProcs)
+	}
+	return sb.String()
+}
+
+func TestScalingSummary(t *testing.T) {
+	throughput := map[string]map[int]float64{
+		"retable":  {1: 100, 2: 190, 4: 360},
+		"reswitch": {1: 100, 2: 110, 4: 120},
+	}
+	tests := []struct {
+		procs  []int
+		numCPU int
+		want   string
+	}{
+		{[]int{1, 2, 4}, 4, "don't scale (speedup below 2.00x at procs=4): reswitch\n"},
+		{[]int{1, 2}, 4, "all routers scale (speedup at least 1.00x at procs=2)\n"},
+		{[]int{1, 2, 4}, 1, "can't measure scaling: need results for 1 proc and more than 1 proc (with 1 CPUs)\n"},
+		{[]int{2, 4}, 4, "can't measure scaling: no baseline, as -procs doesn't include 1\n"},
+	}
+	for _, test := range tests {
+		summary := scalingSummary(throughput, test.procs, test.numCPU)
+		if !strings.HasSuffix(summary, test.want) {
+			t.Errorf("procs %v, %d CPUs: got summary:\n%s\nwant last line %q", test.procs, test.numCPU, summary, test.want)
+		}
+	}
+}
@@ -3,90 +3,62 @@
 package pat
 
 import (
-	"fmt"
 	"net/http"
-	"strconv"
 
 	"github.com/bmizerany/pat"
+
+	"github.com/benhoyt/go-routing/introspect"
+	"github.com/benhoyt/go-routing/widgets"
 )
 
+// pat adds path parameters to the URL's query string, prefixed with ':'
+var handlers = widgets.New(widgets.ParamsFunc(func(r *http.Request, name string) string {
+	return r.URL.Query().Get(":" + name)
+}))
+
 var Serve http.Handler
 
 func init() {
 	r := pat.New()
-
-	r.Get("/", http.HandlerFunc(home))
-	r.Get("/contact", http.HandlerFunc(contact))
-	r.Get("/api/widgets", http.HandlerFunc(apiGetWidgets))
-	r.Post("/api/widgets", http.HandlerFunc(apiCreateWidget))
-	r.Post("/api/widgets/:slug", http.HandlerFunc(apiUpdateWidget))
-	r.Post("/api/widgets/:slug/parts", http.HandlerFunc(apiCreateWidgetPart))
-	r.Post("/api/widgets/:slug/parts/:id/update", http.HandlerFunc(apiUpdateWidgetPart))
-	r.Post("/api/widgets/:slug/parts/:id/delete", http.HandlerFunc(apiDeleteWidgetPart))
-	r.Get("/:slug", http.HandlerFunc(widgetGet))
-	r.Get("/:slug/admin", http.HandlerFunc(widgetAdmin))
-	r.Post("/:slug/image", http.HandlerFunc(widgetImage))
-
+	for _, route := range routes {
+		if route.method == "GET" {
+			r.Get(route.pattern, route.handler) // also registers HEAD
+		} else {
+			r.Add(route.method, route.pattern, route.handler)
+		}
+	}
 	Serve = r
 }
 
-func home(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "home\n")
-}
-
-func contact(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "contact\n")
-}
-
-func apiGetWidgets(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "apiGetWidgets\n")
-}
-
-func apiCreateWidget(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "apiCreateWidget\n")
-}
-
-func apiUpdateWidget(w http.ResponseWriter, r *http.Request) {
-	slug := r.URL.Query().Get(":slug")
-	fmt.Fprintf(w, "apiUpdateWidget %s\n", slug)
-}
-
-func apiCreateWidgetPart(w http.ResponseWriter, r *http.Request) {
-	slug := r.URL.Query().Get(":slug")
-	fmt.Fprintf(w, "apiCreateWidgetPart %s\n", slug)
-}
-
-func apiUpdateWidgetPart(w http.ResponseWriter, r *http.Request) {
-	slug := r.URL.Query().Get(":slug")
-	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
-	if err != nil {
-		http.NotFound(w, r)
-		return
-	}
-	fmt.Fprintf(w, "apiUpdateWidgetPart %s %d\n", slug, id)
+var routes = []struct {
+	method  string
+	pattern string
+	handler http.HandlerFunc
+}{
+	{"GET", "/", handlers.Home},
+	{"GET", "/contact", handlers.Contact},
+	{"GET", "/api/widgets", handlers.GetWidgets},
+	{"POST", "/api/widgets", handlers.CreateWidget},
+	{"POST", "/api/widgets/:slug", handlers.UpdateWidget},
+	{"POST", "/api/widgets/:slug/parts", handlers.CreateWidgetPart},
+	{"POST", "/api/widgets/:slug/parts/:id/update", handlers.UpdateWidgetPart},
+	{"POST", "/api/widgets/:slug/parts/:id/delete", handlers.DeleteWidgetPart},
+	{"GET", "/:slug", handlers.Widget},
+	{"GET", "/:slug/admin", handlers.WidgetAdmin},
+	{"POST", "/:slug/image", handlers.WidgetImage},
 }
 
-func apiDeleteWidgetPart(w http.ResponseWriter, r *http.Request) {
-	slug := r.URL.Query().Get(":slug")
-	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
-	if err != nil {
-		http.NotFound(w, r)
-		return
+// Routes returns the routes registered with Serve, in the order they
+// were registered. PatternServeMux keeps its routes unexported, so
+// they're listed from the same table Serve is built from.
+func Routes() []introspect.RouteInfo {
+	var infos []introspect.RouteInfo
+	for _, route := range routes {
+		infos = append(infos, introspect.RouteInfo{
+			Method:  route.method,
+			Pattern: route.pattern,
+			Handler: introspect.HandlerName(route.handler),
+		})
 	}
-	fmt.Fprintf(w, "apiDeleteWidgetPart %s %d\n", slug, id)
-}
-
-func widgetGet(w http.ResponseWriter, r *http.Request) {
-	slug := r.URL.Query().Get(":slug")
-	fmt.Fprintf(w, "widget %s\n", slug)
-}
-
-func widgetAdmin(w http.ResponseWriter, r *http.Request) {
-	slug := r.URL.Query().Get(":slug")
-	fmt.Fprintf(w, "widgetAdmin %s\n", slug)
-}
-
-func widgetImage(w http.ResponseWriter, r *http.Request) {
-	slug := r.URL.Query().Get(":slug")
-	fmt.Fprintf(w, "widgetImage %s\n", slug)
+	return infos
 }
@@ -3,49 +3,108 @@
 package reswitch
 
 import (
-	"fmt"
 	"net/http"
 	"regexp"
 	"strconv"
 	"sync"
+
+	"github.com/benhoyt/go-routing/internal/autohead"
+	"github.com/benhoyt/go-routing/internal/middleware"
+	"github.com/benhoyt/go-routing/introspect"
+	"github.com/benhoyt/go-routing/widgets"
 )
 
+var handlers = widgets.Default
+
+var stack = middleware.NewStack(http.HandlerFunc(dispatch))
+
+// Use adds middleware that sees every request before it's routed, with
+// the first outermost.
+func Use(mw ...func(http.Handler) http.Handler) {
+	stack.Use(mw...)
+}
+
 func Serve(w http.ResponseWriter, r *http.Request) {
+	stack.ServeHTTP(w, r)
+}
+
+func dispatch(w http.ResponseWriter, r *http.Request) {
 	var h http.Handler
-	var slug string
-	var id int
+	var slug, id string
 
 	p := r.URL.Path
 	switch {
 	case match(p, "/"):
-		h = get(home)
+		h = get(handlers.Home)
 	case match(p, "/contact"):
-		h = get(contact)
-	case match(p, "/api/widgets") && r.Method == "GET":
-		h = get(apiGetWidgets)
+		h = get(handlers.Contact)
+	case match(p, "/api/widgets") && (r.Method == "GET" || r.Method == "HEAD"):
+		h = get(handlers.GetWidgets)
 	case match(p, "/api/widgets"):
-		h = post(apiCreateWidget)
+		h = post(handlers.CreateWidget)
 	case match(p, "/api/widgets/([^/]+)", &slug):
-		h = post(apiWidget{slug}.update)
+		h = post(handlers.UpdateWidget)
 	case match(p, "/api/widgets/([^/]+)/parts", &slug):
-		h = post(apiWidget{slug}.createPart)
+		h = post(handlers.CreateWidgetPart)
 	case match(p, "/api/widgets/([^/]+)/parts/([0-9]+)/update", &slug, &id):
-		h = post(apiWidgetPart{slug, id}.update)
+		h = post(handlers.UpdateWidgetPart)
 	case match(p, "/api/widgets/([^/]+)/parts/([0-9]+)/delete", &slug, &id):
-		h = post(apiWidgetPart{slug, id}.delete)
+		h = post(handlers.DeleteWidgetPart)
 	case match(p, "/([^/]+)", &slug):
-		h = get(widget{slug}.widget)
+		h = get(handlers.Widget)
 	case match(p, "/([^/]+)/admin", &slug):
-		h = get(widget{slug}.admin)
+		h = get(handlers.WidgetAdmin)
 	case match(p, "/([^/]+)/image", &slug):
-		h = post(widget{slug}.image)
+		h = post(handlers.WidgetImage)
 	default:
 		http.NotFound(w, r)
 		return
 	}
+	// Make the parameters available to the handler via r.PathValue
+	if slug != "" {
+		r.SetPathValue("slug", slug)
+	}
+	if id != "" {
+		r.SetPathValue("id", id)
+	}
 	h.ServeHTTP(w, r)
 }
 
+// routeList lists the routes in dispatch's switch statement, in the
+// order they're tried, so that they can be listed by Routes and checked
+// with the lint package. TestRoutes checks that it agrees with dispatch.
+var routeList = []struct {
+	method  string
+	pattern string
+	handler http.HandlerFunc
+}{
+	{"GET", "/", handlers.Home},
+	{"GET", "/contact", handlers.Contact},
+	{"GET", "/api/widgets", handlers.GetWidgets},
+	{"POST", "/api/widgets", handlers.CreateWidget},
+	{"POST", "/api/widgets/([^/]+)", handlers.UpdateWidget},
+	{"POST", "/api/widgets/([^/]+)/parts", handlers.CreateWidgetPart},
+	{"POST", "/api/widgets/([^/]+)/parts/([0-9]+)/update", handlers.UpdateWidgetPart},
+	{"POST", "/api/widgets/([^/]+)/parts/([0-9]+)/delete", handlers.DeleteWidgetPart},
+	{"GET", "/([^/]+)", handlers.Widget},
+	{"GET", "/([^/]+)/admin", handlers.WidgetAdmin},
+	{"POST", "/([^/]+)/image", handlers.WidgetImage},
+}
+
+// Routes returns the routes in dispatch's switch statement, in the order
+// they're tried. Their patterns are regexes, anchored at both ends.
+func Routes() []introspect.RouteInfo {
+	var infos []introspect.RouteInfo
+	for _, route := range routeList {
+		infos = append(infos, introspect.RouteInfo{
+			Method:  route.method,
+			Pattern: route.pattern,
+			Handler: introspect.HandlerName(route.handler),
+		})
+	}
+	return infos
+}
+
 // match reports whether path matches ^regex$, and if it matches,
 // assigns any capture groups to the *string or *int vars.
 func match(path, pattern string, vars ...interface{}) bool {
@@ -71,30 +130,36 @@ func match(path, pattern string, vars ...interface{}) bool {
 	return true
 }
 
-var (
-	regexen = make(map[string]*regexp.Regexp)
-	relock  sync.Mutex
-)
+// regexen caches compiled regexes by pattern. Each pattern is stored
+// once and then only read, which is what sync.Map is optimised for:
+// after warm-up, lookups don't take any locks, so concurrent requests
+// don't contend with each other.
+var regexen sync.Map // map[string]*regexp.Regexp
 
 func mustCompileCached(pattern string) *regexp.Regexp {
-	relock.Lock()
-	defer relock.Unlock()
-
-	regex := regexen[pattern]
-	if regex == nil {
-		regex = regexp.MustCompile("^" + pattern + "$")
-		regexen[pattern] = regex
+	if regex, ok := regexen.Load(pattern); ok {
+		return regex.(*regexp.Regexp)
 	}
-	return regex
+	regex, _ := regexen.LoadOrStore(pattern, regexp.MustCompile("^"+pattern+"$"))
+	return regex.(*regexp.Regexp)
 }
 
 // allowMethod takes a HandlerFunc and wraps it in a handler that only
-// responds if the request method is the given method, otherwise it
-// responds with HTTP 405 Method Not Allowed.
+// responds if the request method is the given method (or HEAD, if the
+// given method is GET), otherwise it responds with HTTP 405 Method Not
+// Allowed.
 func allowMethod(h http.HandlerFunc, method string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if method == "GET" && r.Method == "HEAD" {
+			autohead.Serve(w, r, h)
+			return
+		}
 		if method != r.Method {
-			w.Header().Set("Allow", method)
+			allow := method
+			if method == "GET" {
+				allow += ", HEAD"
+			}
+			w.Header().Set("Allow", allow)
 			http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
@@ -111,60 +176,3 @@ func get(h http.HandlerFunc) http.HandlerFunc {
 func post(h http.HandlerFunc) http.HandlerFunc {
 	return allowMethod(h, "POST")
 }
-
-func home(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "home\n")
-}
-
-func contact(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "contact\n")
-}
-
-func apiGetWidgets(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "apiGetWidgets\n")
-}
-
-func apiCreateWidget(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "apiCreateWidget\n")
-}
-
-type apiWidget struct {
-	slug string
-}
-
-func (h apiWidget) update(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "apiUpdateWidget %s\n", h.slug)
-}
-
-func (h apiWidget) createPart(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "apiCreateWidgetPart %s\n", h.slug)
-}
-
-type apiWidgetPart struct {
-	slug string
-	id   int
-}
-
-func (h apiWidgetPart) update(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "apiUpdateWidgetPart %s %d\n", h.slug, h.id)
-}
-
-func (h apiWidgetPart) delete(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "apiDeleteWidgetPart %s %d\n", h.slug, h.id)
-}
-
-type widget struct {
-	slug string
-}
-
-func (h widget) widget(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "widget %s\n", h.slug)
-}
-
-func (h widget) admin(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "widgetAdmin %s\n", h.slug)
-}
-
-func (h widget) image(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "widgetImage %s\n", h.slug)
-}
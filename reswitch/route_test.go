@@ -0,0 +1,183 @@
+package reswitch
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/benhoyt/go-routing/internal/middleware"
+)
+
+// mutexCache is the regex cache reswitch used to have, which takes a
+// mutex on every lookup. It's kept here to compare against.
+type mutexCache struct {
+	regexen map[string]*regexp.Regexp
+	mu      sync.Mutex
+}
+
+func (c *mutexCache) mustCompileCached(pattern string) *regexp.Regexp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	regex := c.regexen[pattern]
+	if regex == nil {
+		regex = regexp.MustCompile("^" + pattern + "$")
+		c.regexen[pattern] = regex
+	}
+	return regex
+}
+
+func TestMustCompileCached(t *testing.T) {
+	for _, route := range routeList {
+		pattern := route.pattern
+		regex := mustCompileCached(pattern)
+		if regex.String() != "^"+pattern+"$" {
+			t.Errorf("got regex %q for pattern %q", regex, pattern)
+		}
+		if again := mustCompileCached(pattern); again != regex {
+			t.Errorf("pattern %q compiled twice", pattern)
+		}
+	}
+}
+
+// BenchmarkCacheParallel looks up every pattern from parallel goroutines,
+// as Serve does on each request, using the old mutex cache and the
+// current lock-free one. Run with -cpu 1,2,4,8 to see the contention.
+func BenchmarkCacheParallel(b *testing.B) {
+	b.Run("mutex", func(b *testing.B) {
+		cache := &mutexCache{regexen: make(map[string]*regexp.Regexp)}
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				for _, route := range routeList {
+					cache.mustCompileCached(route.pattern)
+				}
+			}
+		})
+	})
+	b.Run("syncmap", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				for _, route := range routeList {
+					mustCompileCached(route.pattern)
+				}
+			}
+		})
+	})
+}
+
+// TestRoutes checks that routeList agrees with dispatch: that it has the
+// same routes in the same order, and that Serve routes a path matching
+// each route's regex, with the route's method, to the route's handler.
+func TestRoutes(t *testing.T) {
+	var listed []string
+	for _, route := range routeList {
+		listed = append(listed, route.method+" "+route.pattern)
+	}
+	if found := dispatchRoutes(t); !slices.Equal(listed, found) {
+		t.Fatalf("routeList has:\n%s\ndispatch has:\n%s",
+			strings.Join(listed, "\n"), strings.Join(found, "\n"))
+	}
+
+	segment := regexp.MustCompile(`\(\[[^]]+\]\+\)`) // a group such as ([^/]+)
+	for _, route := range routeList {
+		path := segment.ReplaceAllString(route.pattern, "1")
+		recorder := httptest.NewRecorder()
+		Serve(recorder, httptest.NewRequest(route.method, path, nil))
+
+		want := httptest.NewRecorder()
+		r := httptest.NewRequest(route.method, path, nil)
+		r.SetPathValue("slug", "1")
+		r.SetPathValue("id", "1")
+		route.handler(want, r)
+
+		if recorder.Code != want.Code || recorder.Body.String() != want.Body.String() {
+			t.Errorf("%s %s: got %d %q, want %d %q", route.method, path,
+				recorder.Code, recorder.Body.String(), want.Code, want.Body.String())
+		}
+	}
+}
+
+// dispatchRoutes returns the routes in dispatch's switch statement, as
+// "METHOD pattern", in the order they're tried. They're found by parsing
+// route.go: each case calls match, possibly with a condition on the
+// method after it, and assigns get(...) or post(...) to h.
+func dispatchRoutes(t *testing.T) []string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "route.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dispatch *ast.FuncDecl
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "dispatch" {
+			dispatch = fn
+		}
+	}
+
+	var routes []string
+	ast.Inspect(dispatch, func(n ast.Node) bool {
+		clause, ok := n.(*ast.CaseClause)
+		if !ok || len(clause.List) == 0 {
+			return true
+		}
+		cond := clause.List[0]
+		if and, ok := cond.(*ast.BinaryExpr); ok && and.Op == token.LAND {
+			cond = and.X
+		}
+		call, ok := cond.(*ast.CallExpr)
+		if !ok || call.Fun.(*ast.Ident).Name != "match" {
+			t.Fatalf("%s: case doesn't call match", fset.Position(clause.Pos()))
+		}
+		pattern, err := strconv.Unquote(call.Args[1].(*ast.BasicLit).Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler := clause.Body[0].(*ast.AssignStmt).Rhs[0].(*ast.CallExpr)
+		method := strings.ToUpper(handler.Fun.(*ast.Ident).Name)
+		routes = append(routes, method+" "+pattern)
+		return false
+	})
+	return routes
+}
+
+func TestUse(t *testing.T) {
+	t.Cleanup(func() { stack = middleware.NewStack(http.HandlerFunc(dispatch)) })
+	var slugs []string
+	Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			// The route's path values are set on the request by then
+			slugs = append(slugs, r.PathValue("slug"))
+		})
+	})
+	tests := []struct {
+		method string
+		path   string
+		status int
+		slug   string
+	}{
+		{"GET", "/", 200, ""},
+		{"GET", "/foo/admin", 200, "foo"},
+		{"POST", "/foo/admin", 405, "foo"},
+		{"GET", "/foo/bar", 404, ""},
+	}
+	for _, test := range tests {
+		slugs = nil
+		recorder := httptest.NewRecorder()
+		Serve(recorder, httptest.NewRequest(test.method, test.path, nil))
+		if recorder.Code != test.status {
+			t.Errorf("%s %s: got status %d, want %d", test.method, test.path, recorder.Code, test.status)
+		}
+		if len(slugs) != 1 || slugs[0] != test.slug {
+			t.Errorf("%s %s: middleware saw slugs %q, want [%q]", test.method, test.path, slugs, test.slug)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package retable
+
+import (
+	"net/http"
+)
+
+// api is the router for the widget API, which Serve mounts under /api.
+var api = NewRouter()
+
+func init() {
+	api.Group("/widgets", func(r *Router) {
+		for _, route := range apiRoutes {
+			r.Handle(route.method, route.pattern, route.handler).Name(route.name)
+		}
+	})
+}
+
+// apiRoutes are the routes of the widget API, relative to /api/widgets.
+var apiRoutes = []struct {
+	name    string
+	method  string
+	pattern string
+	handler http.HandlerFunc
+}{
+	{"getWidgets", "GET", "", handlers.GetWidgets},
+	{"createWidget", "POST", "", handlers.CreateWidget},
+	{"updateWidget", "POST", "/(?P<slug>[^/]+)", handlers.UpdateWidget},
+	{"createWidgetPart", "POST", "/(?P<slug>[^/]+)/parts", handlers.CreateWidgetPart},
+	{"updateWidgetPart", "POST", "/(?P<slug>[^/]+)/parts/(?P<id>[0-9]+)/update", handlers.UpdateWidgetPart},
+	{"deleteWidgetPart", "POST", "/(?P<slug>[^/]+)/parts/(?P<id>[0-9]+)/delete", handlers.DeleteWidgetPart},
+}
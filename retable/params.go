@@ -0,0 +1,277 @@
+package retable
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// namesKey is the path value that lists the names of the groups in the
+// routes that matched a request, separated by spaces, for Param and
+// Params. Group names can't contain spaces, so it can't clash with one.
+const namesKey = "retable params"
+
+// groups describes where a route's named groups are in the paths its
+// regex matches, so that their values can be found without running the
+// regex again to get the submatches, which allocates.
+type groups struct {
+	names string // names of the named groups, separated by spaces
+
+	// withOuter is names joined to the names set by the routes a Router
+	// is mounted under, by those names
+	withOuter *joins
+
+	// If fixed is set, every named group matches exactly one path
+	// segment, at index segments[i] in the path split on slashes, and
+	// for a mounted route the rest of the path starts at the slash after
+	// the first restSegment segments. If not, the regex is used.
+	fixed       bool
+	segments    []int // by group index
+	restSegment int
+}
+
+// newGroups analyzes a route's regex, anchored with "^" and "$". For a
+// mounted route, prefix is the regex without the final group for the
+// rest of the path; otherwise it's "".
+func newGroups(regex *regexp.Regexp, prefix string) groups {
+	var names []string
+	for _, name := range regex.SubexpNames() {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	g := groups{names: strings.Join(names, " "), withOuter: new(joins)}
+
+	source := regex.String()
+	if prefix != "" {
+		source = "^" + prefix + "$"
+	}
+	re, err := syntax.Parse(source, syntax.Perl)
+	if err != nil {
+		panic(err.Error()) // can't happen, as regex compiled
+	}
+	nodes := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		nodes = re.Sub
+	}
+	g.segments = make([]int, regex.NumSubexp()+1)
+	segment := 0
+	for i, node := range nodes {
+		if isNamedCapture(node) {
+			if segment < 0 || hasNamedCapture(node.Sub[0]) || canMatchSlash(node) ||
+				!isSlashBefore(nodes, i) || !isSlashAfter(nodes, i) {
+				return g
+			}
+			g.segments[node.Cap] = segment
+			continue
+		}
+		if hasNamedCapture(node) {
+			return g
+		}
+		switch {
+		case segment < 0:
+		case node.Op == syntax.OpLiteral:
+			segment += strings.Count(string(node.Rune), "/")
+		case canMatchSlash(node):
+			segment = -1 // later groups aren't in a fixed segment
+		}
+	}
+	if prefix != "" && segment < 0 {
+		return g
+	}
+	g.fixed = true
+	g.restSegment = segment
+	return g
+}
+
+func isNamedCapture(re *syntax.Regexp) bool {
+	return re.Op == syntax.OpCapture && re.Name != ""
+}
+
+func hasNamedCapture(re *syntax.Regexp) bool {
+	if isNamedCapture(re) {
+		return true
+	}
+	for _, sub := range re.Sub {
+		if hasNamedCapture(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSlashBefore reports whether nodes[i] is preceded by a literal
+// ending in a slash.
+func isSlashBefore(nodes []*syntax.Regexp, i int) bool {
+	if i == 0 || nodes[i-1].Op != syntax.OpLiteral {
+		return false
+	}
+	runes := nodes[i-1].Rune
+	return runes[len(runes)-1] == '/'
+}
+
+// isSlashAfter reports whether nodes[i] is followed by the end of the
+// path or a literal starting with a slash.
+func isSlashAfter(nodes []*syntax.Regexp, i int) bool {
+	if i == len(nodes)-1 {
+		return true
+	}
+	next := nodes[i+1]
+	return next.Op == syntax.OpEndText || next.Op == syntax.OpLiteral && next.Rune[0] == '/'
+}
+
+// pathSegment returns the nth segment of path split on slashes (the empty
+// text before the leading slash is segment 0).
+func pathSegment(path string, n int) string {
+	for ; n > 0; n-- {
+		i := strings.IndexByte(path, '/')
+		if i < 0 {
+			return ""
+		}
+		path = path[i+1:]
+	}
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
+
+// rest returns the part of path after a mounted route's prefix.
+func (route *route) rest(path string) string {
+	if route.groups.fixed {
+		for n := route.groups.restSegment; n >= 0; n-- {
+			i := strings.IndexByte(path, '/')
+			if i < 0 {
+				return ""
+			}
+			if n == 0 {
+				return path[i:]
+			}
+			path = path[i+1:]
+		}
+	}
+	match := route.regex.FindStringSubmatchIndex(path)
+	n := route.regex.NumSubexp()
+	if match[2*n] < 0 {
+		return ""
+	}
+	return path[match[2*n]:match[2*n+1]]
+}
+
+// setPathValues sets the value of each of the route's named groups on r
+// (empty for groups that didn't participate in matching path), and adds
+// their names to the list Params reads.
+func (route *route) setPathValues(r *http.Request, path string) {
+	if route.groups.names == "" {
+		return
+	}
+	if route.groups.fixed {
+		for i, name := range route.regex.SubexpNames() {
+			if name != "" {
+				r.SetPathValue(name, pathSegment(path, route.groups.segments[i]))
+			}
+		}
+	} else {
+		match := route.regex.FindStringSubmatchIndex(path)
+		for i, name := range route.regex.SubexpNames() {
+			if name == "" {
+				continue
+			}
+			var value string
+			if match[2*i] >= 0 {
+				value = path[match[2*i]:match[2*i+1]]
+			}
+			r.SetPathValue(name, value)
+		}
+	}
+
+	// Values set by an enclosing route, such as a mount's prefix, are
+	// still there, so keep listing them
+	names := route.groups.names
+	if outer := r.PathValue(namesKey); outer != "" {
+		names = route.groups.withOuter.join(outer, func() string {
+			return outer + " " + names
+		})
+	}
+	r.SetPathValue(namesKey, names)
+}
+
+// joins caches strings a route builds by joining one of its own strings,
+// such as its group names, to another, so that each is only built, which
+// allocates, the first time. They're keyed by the other string, which
+// comes from a route of a Router it's mounted under or mounts, so there
+// are only as many as there are such routes.
+type joins struct {
+	mu     sync.Mutex // held by join when it adds a string
+	joined atomic.Pointer[map[string]string]
+}
+
+// join returns the string for key, calling build to build it if it's
+// not cached yet.
+func (j *joins) join(key string, build func() string) string {
+	if m := j.joined.Load(); m != nil {
+		if s, ok := (*m)[key]; ok {
+			return s
+		}
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	m := make(map[string]string)
+	if old := j.joined.Load(); old != nil {
+		maps.Copy(m, *old)
+	}
+	s := build()
+	m[key] = s
+	j.joined.Store(&m)
+	return s
+}
+
+// Param returns the value of the path parameter captured by the named
+// group in the matched route's pattern (which may be empty). It's like
+// r.PathValue, but returns an error if the route has no such group, or
+// r wasn't routed by a Router.
+func Param(r *http.Request, name string) (string, error) {
+	names := r.PathValue(namesKey)
+	for names != "" {
+		var n string
+		n, names, _ = strings.Cut(names, " ")
+		if n == name {
+			return r.PathValue(name), nil
+		}
+	}
+	return "", fmt.Errorf("retable: no path parameter %q", name)
+}
+
+// ParamInt is like Param, but also parses the value as a decimal int,
+// returning an error if it can't be parsed.
+func ParamInt(r *http.Request, name string) (int, error) {
+	s, err := Param(r, name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("retable: path parameter %q: %w", name, err)
+	}
+	return n, nil
+}
+
+// Params returns a map of the named path parameters of the matched
+// route (including those of the prefix of any router it's mounted
+// under), or nil if there are none.
+func Params(r *http.Request) map[string]string {
+	var m map[string]string
+	for _, name := range strings.Fields(r.PathValue(namesKey)) {
+		if m == nil {
+			m = make(map[string]string)
+		}
+		m[name] = r.PathValue(name)
+	}
+	return m
+}
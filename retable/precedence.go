@@ -0,0 +1,158 @@
+package retable
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// specificity ranks a pattern for Router.Precedence. It has a rank for
+// each path segment of the pattern, up to the first part that can match
+// a slash (if any), which is given the lowest rank as it matches any
+// number of segments. For example, "/(?P<slug>[^/]+)/admin(/.*)?" is
+// ranked [literal, wildcard, literal, rest], the first segment being the
+// empty one before the leading slash.
+type specificity struct {
+	segments []segmentRank
+	literal  int // number of runes of literal text before any rest
+}
+
+type segmentRank int
+
+const (
+	rest     segmentRank = iota // from a part that can match a slash
+	wildcard                    // segment with a part that can't
+	literal                     // segment that's only literal text
+)
+
+// moreSpecific reports whether a pattern ranked a should be tried before
+// one ranked b: a literal segment beats a wildcard at the first segment
+// where they differ, and a wildcard beats the rest of the path. If
+// they're ranked the same up to the end of one of them, the one with
+// more segments, and then the one with more literal text, wins.
+func (a specificity) moreSpecific(b specificity) bool {
+	for i := 0; i < len(a.segments) && i < len(b.segments); i++ {
+		if a.segments[i] != b.segments[i] {
+			return a.segments[i] > b.segments[i]
+		}
+	}
+	if len(a.segments) != len(b.segments) {
+		return len(a.segments) > len(b.segments)
+	}
+	return a.literal > b.literal
+}
+
+// newSpecificity ranks a compiled route regex, which is anchored with
+// "^" and "$".
+func newSpecificity(regex *regexp.Regexp) specificity {
+	re, err := syntax.Parse(regex.String(), syntax.Perl)
+	if err != nil {
+		panic(err.Error()) // can't happen, as regex compiled
+	}
+	var s specificity
+	current := literal
+	nodes := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		nodes = re.Sub
+	}
+	for _, node := range nodes {
+		switch {
+		case node.Op == syntax.OpBeginText || node.Op == syntax.OpEndText:
+		case node.Op == syntax.OpLiteral && node.Flags&syntax.FoldCase == 0:
+			text := string(node.Rune)
+			for {
+				before, after, found := strings.Cut(text, "/")
+				s.literal += utf8.RuneCountInString(before)
+				if !found {
+					break
+				}
+				s.segments = append(s.segments, current)
+				current = literal
+				text = after
+			}
+		case canMatchSlash(node):
+			// If the rest of the path starts with a slash, as a mount's
+			// does, it ends the current segment, which is ranked as
+			// usual. Otherwise that segment is ranked as the rest. What
+			// follows is dropped: none of it changes the ranking much,
+			// and the rank must not depend on it.
+			if startsSegment(node) {
+				s.segments = append(s.segments, current)
+			}
+			s.segments = append(s.segments, rest)
+			return s
+		default:
+			current = wildcard
+		}
+	}
+	s.segments = append(s.segments, current)
+	return s
+}
+
+// startsSegment reports whether re can only match empty text or text
+// starting with a slash.
+func startsSegment(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return re.Rune[0] == '/'
+	case syntax.OpCapture, syntax.OpQuest:
+		return startsSegment(re.Sub[0])
+	case syntax.OpConcat:
+		return len(re.Sub) > 0 && startsSegment(re.Sub[0])
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if !startsSegment(sub) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// canMatchSlash reports whether re may match text containing a slash.
+func canMatchSlash(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return true
+	case syntax.OpLiteral:
+		return slices.Contains(re.Rune, '/')
+	case syntax.OpCharClass:
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			if re.Rune[i] <= '/' && '/' <= re.Rune[i+1] {
+				return true
+			}
+		}
+		return false
+	}
+	for _, sub := range re.Sub {
+		if canMatchSlash(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// add adds route to the table, and to the ranking, after any routes
+// that are at least as specific, so that routes ranked the same are
+// tried in the order they were registered.
+func (rt *Router) add(route route) {
+	route.id = strconv.Itoa(len(rt.routes))
+	rt.routes = append(rt.routes, route)
+	i := len(rt.ranked)
+	for i > 0 && route.specificity.moreSpecific(rt.routes[rt.ranked[i-1]].specificity) {
+		i--
+	}
+	rt.ranked = slices.Insert(rt.ranked, i, len(rt.routes)-1)
+}
+
+// index returns the index in rt.routes of the nth route to try.
+func (rt *Router) index(n int) int {
+	if rt.Precedence {
+		return rt.ranked[n]
+	}
+	return n
+}
@@ -3,116 +3,461 @@
 package retable
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/benhoyt/go-routing/internal/autohead"
+	"github.com/benhoyt/go-routing/internal/middleware"
+	"github.com/benhoyt/go-routing/introspect"
+	"github.com/benhoyt/go-routing/widgets"
 )
 
-var routes = []route{
-	newRoute("GET", "/", home),
-	newRoute("GET", "/contact", contact),
-	newRoute("GET", "/api/widgets", apiGetWidgets),
-	newRoute("POST", "/api/widgets", apiCreateWidget),
-	newRoute("POST", "/api/widgets/([^/]+)", apiUpdateWidget),
-	newRoute("POST", "/api/widgets/([^/]+)/parts", apiCreateWidgetPart),
-	newRoute("POST", "/api/widgets/([^/]+)/parts/([0-9]+)/update", apiUpdateWidgetPart),
-	newRoute("POST", "/api/widgets/([^/]+)/parts/([0-9]+)/delete", apiDeleteWidgetPart),
-	newRoute("GET", "/([^/]+)", widget),
-	newRoute("GET", "/([^/]+)/admin", widgetAdmin),
-	newRoute("POST", "/([^/]+)/image", widgetImage),
-}
+var handlers = widgets.Default
+
+var Serve = NewRouter()
 
-func newRoute(method, pattern string, handler http.HandlerFunc) route {
-	return route{method, regexp.MustCompile("^" + pattern + "$"), handler}
+func init() {
+	Serve.Mount("/api", api)
+	for _, r := range routes {
+		Serve.Handle(r.method, r.pattern, r.handler).Name(r.name)
+	}
 }
 
-type route struct {
+var routes = []struct {
+	name    string
 	method  string
-	regex   *regexp.Regexp
+	pattern string
 	handler http.HandlerFunc
+}{
+	{"home", "GET", "/", handlers.Home},
+	{"contact", "GET", "/contact", handlers.Contact},
+	{"widget", "GET", "/(?P<slug>[^/]+)", handlers.Widget},
+	{"widgetAdmin", "GET", "/(?P<slug>[^/]+)/admin", handlers.WidgetAdmin},
+	{"widgetImage", "POST", "/(?P<slug>[^/]+)/image", handlers.WidgetImage},
 }
 
-func Serve(w http.ResponseWriter, r *http.Request) {
-	var allow []string
-	for _, route := range routes {
-		matches := route.regex.FindStringSubmatch(r.URL.Path)
-		if len(matches) > 0 {
-			if r.Method != route.method {
-				allow = append(allow, route.method)
-				continue
-			}
-			ctx := context.WithValue(r.Context(), ctxKey{}, matches[1:])
-			route.handler(w, r.WithContext(ctx))
-			return
+// Router is an HTTP handler that matches the request path against a
+// table of regexes, tried in the order they were registered (or in
+// order of precedence, see the Precedence field). The zero value is an
+// empty router ready to use.
+type Router struct {
+	// Precedence makes the router try routes from the most specific to
+	// the least, like http.ServeMux, rather than in the order they were
+	// registered. Patterns are compared segment by segment: a literal
+	// segment beats one with a group in it, which beats a part of the
+	// pattern that can match a slash, and if they're otherwise the same,
+	// the one with more segments, then more literal text, wins. Routes
+	// that rank the same are tried in the order they were registered.
+	//
+	// Precedence must be set on the router created by NewRouter (a
+	// mounted router has its own setting), and not changed while the
+	// router is serving requests.
+	Precedence bool
+
+	routes []route
+	ranked []int                  // indexes of routes in order of precedence
+	urls   map[string]urlTemplate // by route name
+
+	mounts []mount // mounted routers, for building URLs
+
+	// For routers returned by With and passed to Group functions, the
+	// router that routes are registered with (routes, urls and mounts
+	// are unused), and the prefix added to their patterns
+	parent *Router
+	prefix string
+
+	// Middleware added with Use: for the router created by NewRouter, a
+	// stack around dispatch, created by the first call to Use; for other
+	// routers, the middleware for routes registered with them
+	mu         sync.Mutex // held by Use while it creates the stack
+	stack      atomic.Pointer[middleware.Stack]
+	middleware []func(http.Handler) http.Handler
+}
+
+// NewRouter returns a new, empty router.
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for requests with the given method and a
+// path matching pattern, which is anchored at both ends. Named capture
+// groups in pattern, such as (?P<slug>[^/]+), are made available to the
+// handler via r.PathValue, Param, ParamInt and Params. It panics if
+// pattern is not a valid regex.
+func (rt *Router) Handle(method, pattern string, handler http.Handler) *Route {
+	pattern = rt.prefix + pattern
+	route := rt.newRoute(method, pattern, pattern, handler)
+	top := rt.top()
+	top.add(route)
+	return &Route{top, pattern}
+}
+
+// Mount registers h to handle requests with any method whose path is
+// prefix, or starts with prefix followed by a slash. Like a pattern,
+// prefix is a regex, and the values of its named groups are set on the
+// request.
+//
+// If h is a *Router, its routes are matched against the rest of the
+// path after prefix, and requests it has no route for aren't sent to
+// it, but carry on to the routes registered after the mount. If none of
+// those match either, the methods h allows for the path are listed in
+// the 405 response. The route is found when rt is searched, so h is
+// passed the request itself and doesn't search its routes again, which
+// means its handlers and middleware see the full path.
+//
+// Any other h handles every request under prefix, and is called with a
+// shallow copy of the request with prefix removed from its path (as
+// http.StripPrefix does): if h is mounted under "/api", it sees
+// "/api/widgets" as "/widgets", and "/api" itself as "".
+func (rt *Router) Mount(prefix string, h http.Handler) {
+	prefix = rt.prefix + prefix
+	route := rt.newRoute("*", prefix, prefix+"((?s)/.*)?", h)
+	route.groups = newGroups(route.regex, prefix)
+	route.mounted = true
+	top := rt.top()
+	if sub, ok := h.(*Router); ok {
+		route.sub = sub.top()
+		if t, err := newURLTemplate(prefix); err == nil {
+			top.mounts = append(top.mounts, mount{t, route.sub})
 		}
 	}
-	if len(allow) > 0 {
-		w.Header().Set("Allow", strings.Join(allow, ", "))
-		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+	top.add(route)
+}
+
+// mount is a router mounted with Mount, for building URLs to its named
+// routes.
+type mount struct {
+	prefix urlTemplate
+	sub    *Router
+}
+
+// Group calls fn with a router that registers routes with rt, adding
+// prefix to the start of their patterns (so the pattern "" matches
+// prefix itself). Middleware added to the group's router with Use wraps
+// only the group's routes, as for With, and applies to routes in nested
+// groups too. For example:
+//
+//	rt.Group("/api/widgets", func(r *retable.Router) {
+//		r.Use(requireAuth)
+//		r.Handle("GET", "", getWidgets)
+//		r.Handle("POST", "/(?P<slug>[^/]+)", updateWidget)
+//	})
+func (rt *Router) Group(prefix string, fn func(r *Router)) {
+	fn(rt.child(prefix))
+}
+
+// Use adds middleware to the router, with the first outermost. On a
+// router created by NewRouter, the middleware wraps the handling of
+// every request, including those that result in a 404 or 405 response,
+// so it runs before routing and can't see the path values. On a router
+// returned by With or passed to a Group function, it wraps the handlers
+// of routes registered with that router afterwards, so it runs after
+// routing. Use may be called on a router created by NewRouter while it's
+// serving requests, which keep the middleware they started with.
+func (rt *Router) Use(mw ...func(http.Handler) http.Handler) {
+	if rt.parent != nil {
+		rt.middleware = append(rt.middleware, mw...)
 		return
 	}
-	http.NotFound(w, r)
+	rt.mu.Lock()
+	stack := rt.stack.Load()
+	if stack == nil {
+		stack = middleware.NewStack(http.HandlerFunc(rt.dispatch))
+		rt.stack.Store(stack)
+	}
+	rt.mu.Unlock()
+	stack.Use(mw...)
 }
 
-type ctxKey struct{}
+// With returns a router that registers routes with rt, wrapping their
+// handlers in mw, as well as in any middleware added to rt if it was
+// itself returned by With. This is useful for adding middleware to
+// individual routes, for example:
+//
+//	rt.With(requireAdmin).Handle("GET", "/(?P<slug>[^/]+)/admin", widgetAdmin)
+func (rt *Router) With(mw ...func(http.Handler) http.Handler) *Router {
+	child := rt.child("")
+	child.middleware = append(child.middleware, mw...)
+	return child
+}
 
-func getField(r *http.Request, index int) string {
-	fields := r.Context().Value(ctxKey{}).([]string)
-	return fields[index]
+// child returns a router that registers routes with rt, inheriting its
+// prefix and route middleware.
+func (rt *Router) child(prefix string) *Router {
+	child := &Router{parent: rt, prefix: rt.prefix + prefix}
+	if rt.parent != nil {
+		child.middleware = slices.Clip(rt.middleware)
+	}
+	return child
+}
+
+// top returns the router that routes registered with rt are added to.
+func (rt *Router) top() *Router {
+	for rt.parent != nil {
+		rt = rt.parent
+	}
+	return rt
 }
 
-func home(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "home\n")
+// Route is a registered route, returned by Router.Handle so that it can
+// be named.
+type Route struct {
+	rt      *Router
+	pattern string
+}
+
+// Name names the route so that URLs for it can be built with
+// Router.URL. It panics if the name is already in use, or if the
+// route's pattern contains anything other than literal text and named
+// capture groups.
+func (r *Route) Name(name string) *Route {
+	if _, ok := r.rt.urls[name]; ok {
+		panic(fmt.Sprintf("retable: route name %q is already in use", name))
+	}
+	t, err := newURLTemplate(r.pattern)
+	if err != nil {
+		panic(err.Error())
+	}
+	if r.rt.urls == nil {
+		r.rt.urls = make(map[string]urlTemplate)
+	}
+	r.rt.urls[name] = t
+	return r
 }
 
-func contact(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "contact\n")
+// newRoute returns a route that matches paths matching regex (which
+// newRoute anchors), with rt's middleware around handler if rt is a
+// group.
+func (rt *Router) newRoute(method, pattern, regex string, handler http.Handler) route {
+	re := regexp.MustCompile("^" + regex + "$")
+	route := route{
+		method:      method,
+		pattern:     pattern,
+		regex:       re,
+		specificity: newSpecificity(re),
+		groups:      newGroups(re, ""),
+		handler:     handler,
+		inner:       handler,
+		withNext:    new(joins),
+	}
+	if rt.parent != nil {
+		route.handler = middleware.Wrap(handler, rt.middleware)
+	}
+	return route
 }
 
-func apiGetWidgets(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "apiGetWidgets\n")
+type route struct {
+	id          string // index in the router's routes, see routeKey
+	withNext    *joins // id joined to the routeKeys of a mounted Router
+	method      string
+	pattern     string
+	regex       *regexp.Regexp
+	specificity specificity
+	groups      groups
+	handler     http.Handler
+	inner       http.Handler // handler before it was wrapped in middleware
+
+	// For routes added by Mount, which match any method and whose regex
+	// has a final group for the rest of the path
+	mounted bool
+	sub     *Router // the mounted router, if handler is one
 }
 
-func apiCreateWidget(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "apiCreateWidget\n")
+// Routes returns the routes registered with rt, in the order they're
+// tried, which is their order of precedence if rt.Precedence is set.
+// The routes of a mounted Router are listed in its place, with the
+// prefix added to their patterns; any other mounted handler is listed
+// with the method "*".
+func (rt *Router) Routes() []introspect.RouteInfo {
+	rt = rt.top()
+	routes := make([]introspect.RouteInfo, 0, len(rt.routes))
+	for n := range rt.routes {
+		route := rt.routes[rt.index(n)]
+		if route.sub != nil {
+			for _, info := range route.sub.Routes() {
+				info.Pattern = route.pattern + info.Pattern
+				routes = append(routes, info)
+			}
+			continue
+		}
+		pattern := route.pattern
+		if route.mounted {
+			pattern += "((?s)/.*)?"
+		}
+		routes = append(routes, introspect.RouteInfo{
+			Method:  route.method,
+			Pattern: pattern,
+			Handler: introspect.HandlerName(route.inner),
+		})
+	}
+	return routes
 }
 
-func apiUpdateWidget(w http.ResponseWriter, r *http.Request) {
-	slug := getField(r, 0)
-	fmt.Fprintf(w, "apiUpdateWidget %s\n", slug)
+// ServeHTTP dispatches the request to the first route whose method and
+// pattern match, with GET routes also answering HEAD requests (with the
+// response body discarded). If the path matches but the method doesn't,
+// it responds with 405 Method Not Allowed and an Allow header listing
+// the methods of the routes that did match.
+//
+// The values of the route's named groups are set on the request with
+// SetPathValue, rather than stored in a new context, so that routing a
+// request doesn't copy it.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt = rt.top()
+	if stack := rt.stack.Load(); stack != nil {
+		stack.ServeHTTP(w, r)
+		return
+	}
+	rt.dispatch(w, r)
 }
 
-func apiCreateWidgetPart(w http.ResponseWriter, r *http.Request) {
-	slug := getField(r, 0)
-	fmt.Fprintf(w, "apiCreateWidgetPart %s\n", slug)
+// routeKey is the path value a Router sets on a request it passes to a
+// mounted Router, so that the mounted one can serve the route it has
+// already been searched for. It's the id of the route in the mounted
+// Router, followed by the ids of the routes in any Routers mounted under
+// it, separated by dots. pathKey is the rest of the path after the
+// mount's prefix. Wildcard names are Go identifiers, so these can't
+// clash with ServeMux's path values.
+const (
+	routeKey = "retable route"
+	pathKey  = "retable path"
+)
+
+func (rt *Router) dispatch(w http.ResponseWriter, r *http.Request) {
+	var route *route
+	var path, rest, next string
+	var allow []string
+	if key := r.PathValue(routeKey); key != "" {
+		route, next = rt.route(key)
+		path = r.PathValue(pathKey)
+		// Clear them, in case the route's handler is a Router too
+		r.SetPathValue(routeKey, "")
+		r.SetPathValue(pathKey, "")
+		if route.mounted {
+			rest = route.rest(path)
+		}
+	} else {
+		path = r.URL.Path
+		route, rest, next, allow = rt.find(r.Method, path)
+	}
+
+	switch {
+	case route != nil && route.sub != nil:
+		if route.regex.NumSubexp() > 1 {
+			route.setPathValues(r, path)
+		}
+		r.SetPathValue(routeKey, next)
+		r.SetPathValue(pathKey, rest)
+		route.handler.ServeHTTP(w, r)
+	case route != nil && route.mounted:
+		route.serveMounted(w, r, path, rest)
+	case route != nil:
+		route.setPathValues(r, path)
+		if r.Method == "HEAD" && route.method == "GET" {
+			autohead.Serve(w, r, route.handler)
+			return
+		}
+		route.handler.ServeHTTP(w, r)
+	case len(allow) > 0:
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
 }
 
-func apiUpdateWidgetPart(w http.ResponseWriter, r *http.Request) {
-	slug := getField(r, 0)
-	id, _ := strconv.Atoi(getField(r, 1))
-	fmt.Fprintf(w, "apiUpdateWidgetPart %s %d\n", slug, id)
+// route returns the route with the first id in key, a routeKey value,
+// and the rest of key.
+func (rt *Router) route(key string) (route *route, next string) {
+	id, next, _ := strings.Cut(key, ".")
+	i, err := strconv.Atoi(id)
+	if err != nil || i < 0 || i >= len(rt.routes) {
+		panic(fmt.Sprintf("retable: invalid %q path value %q", routeKey, key))
+	}
+	return &rt.routes[i], next
 }
 
-func apiDeleteWidgetPart(w http.ResponseWriter, r *http.Request) {
-	slug := getField(r, 0)
-	id, _ := strconv.Atoi(getField(r, 1))
-	fmt.Fprintf(w, "apiDeleteWidgetPart %s %d\n", slug, id)
+// find returns the first route that matches method and path, and if
+// it's a mounted route, the rest of the path after its prefix. If it's
+// a mounted Router, which only matches if it has a route for method and
+// the rest of the path, find also returns the routeKey for that route.
+// If no route matches, it returns nil and the methods allowed for path,
+// if any.
+func (rt *Router) find(method, path string) (route *route, rest, next string, allow []string) {
+	for n := range rt.routes {
+		route := &rt.routes[rt.index(n)]
+		if !route.regex.MatchString(path) {
+			continue
+		}
+		if route.mounted {
+			rest := route.rest(path)
+			if route.sub == nil {
+				return route, rest, "", nil
+			}
+			found, _, subNext, subAllow := route.sub.find(method, rest)
+			if found != nil {
+				next := found.id
+				if subNext != "" {
+					next = found.withNext.join(subNext, func() string {
+						return found.id + "." + subNext
+					})
+				}
+				return route, rest, next, nil
+			}
+			for _, m := range subAllow {
+				allow = addAllowed(allow, m)
+			}
+			continue
+		}
+		if method != route.method && !(method == "HEAD" && route.method == "GET") {
+			allow = addAllowed(allow, route.method)
+			continue
+		}
+		return route, "", "", nil
+	}
+	return nil, "", "", allow
 }
 
-func widget(w http.ResponseWriter, r *http.Request) {
-	slug := getField(r, 0)
-	fmt.Fprintf(w, "widget %s\n", slug)
+// serveMounted serves r with a mounted route's handler (other than a
+// Router), passing it a copy of r with the path set to rest (as
+// http.StripPrefix does). Copying r and its URL allocates, but r can't
+// be changed, as middleware that called the router may still use it.
+func (route *route) serveMounted(w http.ResponseWriter, r *http.Request, path, rest string) {
+	if route.regex.NumSubexp() > 1 {
+		route.setPathValues(r, path)
+	}
+	r2 := new(http.Request)
+	*r2 = *r
+	u := *r.URL
+	u.Path = rest
+	u.RawPath = ""
+	r2.URL = &u
+	route.handler.ServeHTTP(w, r2)
 }
 
-func widgetAdmin(w http.ResponseWriter, r *http.Request) {
-	slug := getField(r, 0)
-	fmt.Fprintf(w, "widgetAdmin %s\n", slug)
+// addAllowed adds method to the list of allowed methods if it's not
+// already present, along with HEAD if method is GET.
+func addAllowed(allow []string, method string) []string {
+	if !contains(allow, method) {
+		allow = append(allow, method)
+	}
+	if method == "GET" && !contains(allow, "HEAD") {
+		allow = append(allow, "HEAD")
+	}
+	return allow
 }
 
-func widgetImage(w http.ResponseWriter, r *http.Request) {
-	slug := getField(r, 0)
-	fmt.Fprintf(w, "widgetImage %s\n", slug)
+func contains(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,524 @@
+package retable
+
+import (
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/benhoyt/go-routing/routertest"
+)
+
+func TestHandle(t *testing.T) {
+	rt := NewRouter()
+	body := func(s string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s\n", s, r.PathValue("slug"))
+		})
+	}
+	rt.Handle("GET", "/", body("home"))
+	rt.Handle("GET", "/new", body("new"))
+	rt.Handle("GET", "/(?P<slug>[^/]+)", body("get"))
+	rt.Handle("POST", "/(?P<slug>[^/]+)", body("post"))
+	rt.Handle("DELETE", "/(?P<slug>[a-z]+)", body("delete"))
+
+	routertest.RunCases(t, rt, []routertest.Case{
+		{Method: "GET", Path: "/", Status: 200, Body: "home \n"},
+		{Method: "GET", Path: "/new", Status: 200, Body: "new \n"}, // first match wins
+		{Method: "GET", Path: "/foo", Status: 200, Body: "get foo\n"},
+		{Method: "HEAD", Path: "/foo", Status: 200, Body: "get foo\n"},
+		{Method: "POST", Path: "/new", Status: 200, Body: "post new\n"},
+		{Method: "DELETE", Path: "/foo", Status: 200, Body: "delete foo\n"},
+		{Method: "DELETE", Path: "/123", Status: 405, Allow: "GET, HEAD, POST"},
+		{Method: "PUT", Path: "/", Status: 405, Allow: "GET, HEAD"},
+		{Method: "GET", Path: "/foo/", Status: 404}, // patterns are anchored
+		{Method: "GET", Path: "/foo/bar", Status: 404},
+	})
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Handle didn't panic for an invalid regex")
+		}
+	}()
+	rt.Handle("GET", "/(", body("bad"))
+}
+
+func TestURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		params []string
+		want   string
+		err    string
+	}{
+		{"home", nil, "/", ""},
+		{"getWidgets", nil, "/api/widgets", ""},
+		{"updateWidgetPart", []string{"slug", "foo", "id", "1"}, "/api/widgets/foo/parts/1/update", ""},
+		{"updateWidgetPart", []string{"id", "42", "slug", "bar-baz"}, "/api/widgets/bar-baz/parts/42/update", ""},
+		{"widget", []string{"slug", "a b"}, "/a%20b", ""},
+		{"nope", nil, "", `no route named "nope"`},
+		{"widget", []string{"slug"}, "", "odd number of params"},
+		{"updateWidgetPart", []string{"slug", "foo"}, "", `missing param "id"`},
+		{"updateWidgetPart", []string{"slug", "foo", "id", "x"}, "", `param "id" value "x" doesn't match [0-9]+`},
+		{"widget", []string{"slug", "a/b"}, "", `param "slug" value "a/b" doesn't match [^/]+`},
+		{"widget", []string{"slug", ""}, "", `param "slug" value "" doesn't match [^/]+`},
+		{"widget", []string{"slug", "foo", "id", "1"}, "", `has no param "id"`},
+	}
+	for _, test := range tests {
+		got, err := Serve.URL(test.name, test.params...)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("URL(%q, %q): got error %v, want %q", test.name, test.params, err, test.err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("URL(%q, %q): got %q, %v, want %q", test.name, test.params, got, err, test.want)
+		}
+	}
+}
+
+// TestURLRoundTrip checks that the URL built for each named route is
+// routed back to that route, with the same parameters.
+func TestURLRoundTrip(t *testing.T) {
+	var gotName, gotSlug string
+	rt := NewRouter()
+	for _, name := range []string{"plain", "escaped", "rest"} {
+		pattern := map[string]string{
+			"plain":   "/plain/(?P<slug>[^/]+)",
+			"escaped": "/escaped/(?P<slug>[^/]+)",
+			"rest":    "/rest/(?P<slug>.+)",
+		}[name]
+		rt.Handle("GET", pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotName, gotSlug = name, r.PathValue("slug")
+		})).Name(name)
+	}
+	for name, slug := range map[string]string{"plain": "foo", "escaped": "a b?#%", "rest": "x/y/z"} {
+		u, err := rt.URL(name, "slug", slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", u, nil))
+		if gotName != name || gotSlug != slug {
+			t.Errorf("%s %q: routed to %s with slug %q", name, u, gotName, gotSlug)
+		}
+	}
+}
+
+func TestNamePanics(t *testing.T) {
+	for _, pattern := range []string{"/(a|b)", "/([^/]+)", "/x*", "/(?i)foo"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Name didn't panic for %q", pattern)
+				}
+			}()
+			NewRouter().Handle("GET", pattern, http.NotFoundHandler()).Name("x")
+		}()
+	}
+}
+
+// tag returns middleware that appends name to the X-Trace header, then
+// calls the next handler.
+func tag(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	rt := NewRouter()
+	rt.Use(tag("a"), tag("b"))
+	slug := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Trace", "slug="+r.PathValue("slug"))
+	}
+	rt.Handle("GET", "/plain", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	admin := rt.With(tag("c"))
+	admin.Use(tag("d"))
+	admin.Handle("GET", "/(?P<slug>[^/]+)/admin", http.HandlerFunc(slug)).Name("admin")
+	admin.With(tag("e")).Handle("POST", "/(?P<slug>[^/]+)/image", http.HandlerFunc(slug))
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		trace  string
+	}{
+		{"GET", "/plain", 200, "a b"},
+		{"GET", "/foo/admin", 200, "a b c d slug=foo"},
+		{"POST", "/foo/image", 200, "a b c d e slug=foo"},
+		{"GET", "/foo/image", 405, "a b"},
+		{"GET", "/nope/nope/nope", 404, "a b"},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		admin.ServeHTTP(recorder, httptest.NewRequest(test.method, test.path, nil))
+		trace := strings.Join(recorder.Header()["X-Trace"], " ")
+		if recorder.Code != test.status || trace != test.trace {
+			t.Errorf("%s %s: got %d %q, want %d %q", test.method, test.path,
+				recorder.Code, trace, test.status, test.trace)
+		}
+	}
+
+	if u, err := rt.URL("admin", "slug", "foo"); err != nil || u != "/foo/admin" {
+		t.Errorf(`URL("admin"): got %q, %v, want "/foo/admin"`, u, err)
+	}
+	if routes := admin.Routes(); len(routes) != 3 || routes[1].Handler != "retable.TestMiddleware.func1" {
+		t.Errorf("Routes: got %v", routes)
+	}
+}
+
+// TestConcurrentUse checks (when run with -race) that middleware can be
+// added while the router is serving requests.
+func TestConcurrentUse(t *testing.T) {
+	var rt Router
+	rt.Handle("GET", "/", http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	trace := func() string {
+		recorder := httptest.NewRecorder()
+		rt.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+		return strings.Join(recorder.Header()["X-Trace"], " ")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			rt.Use(tag("x"))
+		}()
+		go func() {
+			defer wg.Done()
+			trace()
+		}()
+	}
+	wg.Wait()
+	if got, want := trace(), "x x x x"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestGroupAndMount(t *testing.T) {
+	slug := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Trace", "slug="+r.PathValue("slug")+" path="+r.URL.Path)
+	}
+	sub := NewRouter()
+	sub.Group("/widgets", func(r *Router) {
+		r.Use(tag("widgets"))
+		r.Handle("GET", "", http.HandlerFunc(slug)).Name("widgets")
+		r.Group("/(?P<slug>[^/]+)", func(r *Router) {
+			r.Use(tag("widget"))
+			r.Handle("POST", "", http.HandlerFunc(slug)).Name("widget")
+		})
+	})
+
+	// Mounted in the mounted router, to check nested mounts
+	version := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Trace", "version="+r.PathValue("version")+" path="+r.URL.Path)
+	}
+	v := NewRouter()
+	v.Use(tag("v"))
+	v.Handle("GET", "/status", http.HandlerFunc(version))
+	v.Mount("/raw", http.HandlerFunc(version))
+	// A Router that's a route's handler rather than mounted sees the
+	// whole path too, and does its own search
+	inner := NewRouter()
+	inner.Handle("GET", "/api/v(?P<version>[0-9]+)/inner", http.HandlerFunc(version))
+	v.Handle("GET", "/inner", inner)
+	sub.Use(tag("sub"))
+	sub.Mount("/v(?P<version>[0-9]+)", v)
+
+	rt := NewRouter()
+	rt.Use(tag("root"))
+	rt.Mount("/api", sub)
+	rt.Handle("PUT", "/(?P<slug>[^/]+)/widgets", http.HandlerFunc(slug))
+	rt.Handle("GET", "/(?P<slug>[^/]+)", http.HandlerFunc(slug))
+	rt.With(tag("files")).Mount("/files/(?P<slug>[^/]+)", http.HandlerFunc(slug))
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		trace  string
+		allow  string
+	}{
+		// A mounted router is passed the request itself, with its path
+		{"GET", "/api/widgets", 200, "root sub widgets slug= path=/api/widgets", ""},
+		{"POST", "/api/widgets/foo", 200, "root sub widgets widget slug=foo path=/api/widgets/foo", ""},
+		{"HEAD", "/api/widgets", 200, "root sub widgets slug= path=/api/widgets", ""},
+		{"GET", "/api/v2/status", 200, "root sub v version=2 path=/api/v2/status", ""},
+		{"HEAD", "/api/v2/status", 200, "root sub v version=2 path=/api/v2/status", ""},
+		{"POST", "/api/v2/status", 405, "root", "GET, HEAD"},
+		{"GET", "/api/v2/raw/a/b", 200, "root sub v version=2 path=/a/b", ""},
+		{"GET", "/api/v2/inner", 200, "root sub v version=2 path=/api/v2/inner", ""},
+		// Not found in the mounted router, so on to the root's routes
+		{"GET", "/api", 200, "root slug=api path=/api", ""},
+		{"PUT", "/api/widgets", 200, "root slug=api path=/api/widgets", ""},
+		{"GET", "/api/nope", 404, "root", ""},
+		// Methods allowed by the mounted router and the root are merged
+		{"DELETE", "/api/widgets", 405, "root", "GET, HEAD, PUT"},
+		{"GET", "/api/widgets/foo", 405, "root", "POST"},
+		{"GET", "/files/foo", 200, "root files slug=foo path=", ""},
+		{"DELETE", "/files/foo/a/b", 200, "root files slug=foo path=/a/b", ""},
+		{"GET", "/files", 200, "root slug=files path=/files", ""},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		rt.ServeHTTP(recorder, httptest.NewRequest(test.method, test.path, nil))
+		trace := strings.Join(recorder.Header()["X-Trace"], " ")
+		allow := recorder.Header().Get("Allow")
+		if recorder.Code != test.status || trace != test.trace || allow != test.allow {
+			t.Errorf("%s %s: got %d %q Allow %q, want %d %q Allow %q", test.method, test.path,
+				recorder.Code, trace, allow, test.status, test.trace, test.allow)
+		}
+	}
+
+	if got, err := rt.URL("widgets"); err != nil || got != "/api/widgets" {
+		t.Errorf(`URL("widgets"): got %q, %v, want "/api/widgets"`, got, err)
+	}
+	if got, err := rt.URL("widget", "slug", "foo"); err != nil || got != "/api/widgets/foo" {
+		t.Errorf(`URL("widget"): got %q, %v, want "/api/widgets/foo"`, got, err)
+	}
+
+	var patterns []string
+	for _, route := range rt.Routes() {
+		patterns = append(patterns, route.Method+" "+route.Pattern)
+	}
+	want := []string{
+		"GET /api/widgets",
+		"POST /api/widgets/(?P<slug>[^/]+)",
+		"GET /api/v(?P<version>[0-9]+)/status",
+		"* /api/v(?P<version>[0-9]+)/raw((?s)/.*)?",
+		"GET /api/v(?P<version>[0-9]+)/inner",
+		"PUT /(?P<slug>[^/]+)/widgets",
+		"GET /(?P<slug>[^/]+)",
+		"* /files/(?P<slug>[^/]+)((?s)/.*)?",
+	}
+	if !slices.Equal(patterns, want) {
+		t.Errorf("Routes: got %q, want %q", patterns, want)
+	}
+}
+
+// TestPrecedence checks that a router with Precedence set passes the
+// conformance tests whatever order the routes are registered in.
+// TestMountAllocs checks that routing through nested mounts, with named
+// groups at each level, doesn't allocate once a request has a map of path
+// values, apart from the first time, when the lists of routes and group
+// names are built.
+func TestMountAllocs(t *testing.T) {
+	teams := NewRouter()
+	teams.Handle("GET", "/widgets/(?P<slug>[^/]+)", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	orgs := NewRouter()
+	orgs.Mount("/teams/(?P<team>[^/]+)", teams)
+	rt := NewRouter()
+	rt.Mount("/orgs/(?P<org>[^/]+)", orgs)
+
+	r := httptest.NewRequest("GET", "/orgs/a/teams/b/widgets/c", nil)
+	r.SetPathValue("other", "") // so that SetPathValue doesn't create the map
+	w := httptest.NewRecorder()
+	allocs := testing.AllocsPerRun(100, func() {
+		r.SetPathValue(namesKey, "") // as for a new request
+		rt.ServeHTTP(w, r)
+	})
+	if allocs != 0 {
+		t.Errorf("got %g allocs per request, want 0", allocs)
+	}
+	if got, want := Params(r), map[string]string{"org": "a", "team": "b", "slug": "c"}; !maps.Equal(got, want) {
+		t.Errorf("Params: got %q, want %q", got, want)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	for seed := uint64(0); seed < 20; seed++ {
+		rng := rand.New(rand.NewPCG(seed, seed))
+		top := slices.Clone(routes)
+		rng.Shuffle(len(top), func(i, j int) { top[i], top[j] = top[j], top[i] })
+		sub := slices.Clone(apiRoutes)
+		rng.Shuffle(len(sub), func(i, j int) { sub[i], sub[j] = sub[j], sub[i] })
+
+		api := NewRouter()
+		api.Precedence = true
+		for _, r := range sub {
+			api.Handle(r.method, "/widgets"+r.pattern, r.handler)
+		}
+		rt := NewRouter()
+		rt.Precedence = true
+		mountAt := rng.IntN(len(top) + 1)
+		for i, r := range top {
+			if i == mountAt {
+				rt.Mount("/api", api)
+			}
+			rt.Handle(r.method, r.pattern, r.handler)
+		}
+		if mountAt == len(top) {
+			rt.Mount("/api", api)
+		}
+
+		t.Run(fmt.Sprint(seed), func(t *testing.T) {
+			routertest.Run(t, rt)
+		})
+	}
+
+	// A mount's literal prefix beats a wildcard segment
+	body := func(s string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, s)
+		})
+	}
+	rt := NewRouter()
+	rt.Precedence = true
+	rt.Handle("GET", "/(?P<a>[^/]+)/(?P<rest>.*)", body("wildcard"))
+	rt.Mount("/static", body("static"))
+	routertest.RunCases(t, rt, []routertest.Case{
+		{Method: "GET", Path: "/static/app.css", Status: 200, Body: "static\n"},
+		{Method: "GET", Path: "/other/app.css", Status: 200, Body: "wildcard\n"},
+	})
+}
+
+func TestSpecificity(t *testing.T) {
+	// In order from most to least specific
+	patterns := []string{
+		"/contact/admin",
+		"/static((?s)/.*)?", // as for Mount("/static", h)
+		"/files/(?P<path>.+)",
+		"/contact",
+		"/(?P<slug>[^/]+)/admin",
+		"/(?P<a>[^/]+)/(?P<rest>.*)",
+		"/w-(?P<slug>[^/]+)",
+		"/(?P<slug>[^/]+)",
+		"/(?P<path>.*)",
+	}
+	for i, a := range patterns {
+		for j, b := range patterns {
+			sa := newSpecificity(regexp.MustCompile("^" + a + "$"))
+			sb := newSpecificity(regexp.MustCompile("^" + b + "$"))
+			if got := sa.moreSpecific(sb); got != (i < j) {
+				t.Errorf("%q more specific than %q: got %v, want %v", a, b, got, i < j)
+			}
+		}
+	}
+
+	rt := NewRouter()
+	rt.Precedence = true
+	for i := len(patterns) - 1; i >= 0; i-- {
+		rt.Handle("GET", patterns[i], http.NotFoundHandler())
+	}
+	var got []string
+	for _, route := range rt.Routes() {
+		got = append(got, route.Pattern)
+	}
+	if !slices.Equal(got, patterns) {
+		t.Errorf("Routes: got %q, want %q", got, patterns)
+	}
+}
+
+// TestPathValues checks that the values of named groups, which are
+// sliced out of the path when they're whole segments, are the same as
+// the regex's submatches.
+func TestPathValues(t *testing.T) {
+	tests := []struct {
+		pattern string
+		fixed   bool
+		paths   []string
+	}{
+		{"/(?P<slug>[^/]+)/parts/(?P<id>[0-9]+)", true, []string{"/foo/parts/1", "/a-b/parts/007"}},
+		{"/(?P<a>[^/]*)/(?P<b>[^/]*)", true, []string{"//", "/x/", "//y"}},
+		{"/w-(?P<slug>[^/]+)", false, []string{"/w-foo"}},
+		{"/(?P<a>[a-z]+)(?P<b>[0-9]+)", false, []string{"/abc123"}},
+		{"/(?P<x>a|b)?/c", false, []string{"/a/c", "//c"}},
+		{"/files/(?P<path>.+)", false, []string{"/files/a/b"}},
+		{"/(.*)/(?P<slug>[^/]+)", false, []string{"/a/b/c"}},
+		{"/(?P<slug>[^/]+)/(.*)", true, []string{"/a/b/c", "/a/"}},
+		{"/(?i:API)/(?P<slug>[^/]+)", true, []string{"/api/foo", "/Api/bar"}},
+	}
+	for _, test := range tests {
+		rt := NewRouter()
+		var got map[string]string
+		rt.Handle("GET", test.pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = Params(r)
+		}))
+		if rt.routes[0].groups.fixed != test.fixed {
+			t.Errorf("%q: got fixed %v, want %v", test.pattern, rt.routes[0].groups.fixed, test.fixed)
+		}
+		for _, path := range test.paths {
+			got = nil
+			rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+			re := rt.routes[0].regex
+			want := make(map[string]string)
+			match := re.FindStringSubmatch(path)
+			for i, name := range re.SubexpNames() {
+				if name != "" {
+					want[name] = match[i]
+				}
+			}
+			if !maps.Equal(got, want) {
+				t.Errorf("%q %q: got %q, want %q", test.pattern, path, got, want)
+			}
+		}
+	}
+}
+
+func TestParam(t *testing.T) {
+	rt := NewRouter()
+	var r *http.Request
+	rt.Handle("GET", "/(?P<slug>[^/]*)/(?P<id>[^/]+)", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r = req
+	}))
+	serve := func(path string) {
+		r = nil
+		rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		if r == nil {
+			t.Fatalf("%s wasn't routed", path)
+		}
+	}
+
+	serve("/foo/007")
+	if slug, err := Param(r, "slug"); err != nil || slug != "foo" {
+		t.Errorf(`Param("slug"): got %q, %v, want "foo"`, slug, err)
+	}
+	if id, err := ParamInt(r, "id"); err != nil || id != 7 {
+		t.Errorf(`ParamInt("id"): got %d, %v, want 7`, id, err)
+	}
+	if got, want := Params(r), map[string]string{"slug": "foo", "id": "007"}; !maps.Equal(got, want) {
+		t.Errorf("Params: got %q, want %q", got, want)
+	}
+
+	// Missing group
+	if s, err := Param(r, "nope"); err == nil {
+		t.Errorf(`Param("nope"): got %q, want error`, s)
+	}
+	if n, err := ParamInt(r, "nope"); err == nil {
+		t.Errorf(`ParamInt("nope"): got %d, want error`, n)
+	}
+	// Not an integer
+	if n, err := ParamInt(r, "slug"); err == nil || !strings.Contains(err.Error(), `path parameter "slug"`) {
+		t.Errorf(`ParamInt("slug"): got %d, %v, want error`, n, err)
+	}
+
+	// Empty value
+	serve("//x")
+	if slug, err := Param(r, "slug"); err != nil || slug != "" {
+		t.Errorf(`Param("slug") when empty: got %q, %v, want ""`, slug, err)
+	}
+	if n, err := ParamInt(r, "slug"); err == nil {
+		t.Errorf(`ParamInt("slug") when empty: got %d, want error`, n)
+	}
+	if got, want := Params(r), map[string]string{"slug": "", "id": "x"}; !maps.Equal(got, want) {
+		t.Errorf("Params when empty: got %q, want %q", got, want)
+	}
+
+	// Not routed by a Router
+	r = httptest.NewRequest("GET", "/foo/1", nil)
+	if s, err := Param(r, "slug"); err == nil {
+		t.Errorf(`Param on unrouted request: got %q, want error`, s)
+	}
+	if got := Params(r); got != nil {
+		t.Errorf("Params on unrouted request: got %q, want nil", got)
+	}
+}
@@ -0,0 +1,138 @@
+package retable
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+)
+
+// urlTemplate is a route's pattern parsed for building URLs: a sequence
+// of literal text and named parameters.
+type urlTemplate []urlPart
+
+type urlPart struct {
+	literal string
+	param   string         // parameter name, if this is a parameter
+	group   string         // the parameter's group, such as "[^/]+"
+	regex   *regexp.Regexp // group, anchored at both ends
+}
+
+// newURLTemplate parses pattern into a urlTemplate, returning an error
+// if it contains anything other than literal text and named groups.
+func newURLTemplate(pattern string) (urlTemplate, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	var t urlTemplate
+	if err := t.add(re); err != nil {
+		return nil, fmt.Errorf("retable: can't build URLs for %q: %w", pattern, err)
+	}
+	return t, nil
+}
+
+func (t *urlTemplate) add(re *syntax.Regexp) error {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return fmt.Errorf("case-insensitive text %q", re)
+		}
+		*t = append(*t, urlPart{literal: string(re.Rune)})
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if err := t.add(sub); err != nil {
+				return err
+			}
+		}
+	case syntax.OpCapture:
+		if re.Name == "" {
+			return errors.New("unnamed group")
+		}
+		group := re.Sub[0].String()
+		regex, err := regexp.Compile("^(?:" + group + ")$")
+		if err != nil {
+			return err
+		}
+		*t = append(*t, urlPart{param: re.Name, group: group, regex: regex})
+	default:
+		return fmt.Errorf("%q outside a named group", re)
+	}
+	return nil
+}
+
+// URL builds the URL path for the route with the given name, substituting
+// params, which are alternating parameter names and values, for its
+// named groups. It returns an error if there's no such route, or if a
+// parameter is missing, unknown, or has a value its group doesn't match.
+//
+// For example, given a route named "part" with the pattern
+// "/widgets/(?P<slug>[^/]+)/parts/(?P<id>[0-9]+)":
+//
+//	rt.URL("part", "slug", "foo", "id", "1") // "/widgets/foo/parts/1"
+//	rt.URL("part", "slug", "foo", "id", "x") // error, as id must match [0-9]+
+func (rt *Router) URL(name string, params ...string) (string, error) {
+	t, ok := rt.template(name)
+	if !ok {
+		return "", fmt.Errorf("retable: no route named %q", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("retable: route %q: odd number of params", name)
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+
+	var sb strings.Builder
+	for _, part := range t {
+		if part.param == "" {
+			sb.WriteString(part.literal)
+			continue
+		}
+		value, ok := values[part.param]
+		if !ok {
+			return "", fmt.Errorf("retable: route %q: missing param %q", name, part.param)
+		}
+		if !part.regex.MatchString(value) {
+			return "", fmt.Errorf("retable: route %q: param %q value %q doesn't match %s",
+				name, part.param, value, part.group)
+		}
+		sb.WriteString(value)
+	}
+	for i := 0; i < len(params); i += 2 {
+		if !t.hasParam(params[i]) {
+			return "", fmt.Errorf("retable: route %q has no param %q", name, params[i])
+		}
+	}
+	return (&url.URL{Path: sb.String()}).EscapedPath(), nil
+}
+
+// template returns the URL template for the named route, looking in
+// mounted routers too (routers mounted under a prefix that can't be
+// reversed are skipped).
+func (rt *Router) template(name string) (urlTemplate, bool) {
+	rt = rt.top()
+	if t, ok := rt.urls[name]; ok {
+		return t, true
+	}
+	for _, m := range rt.mounts {
+		if t, ok := m.sub.template(name); ok {
+			return append(slices.Clip(m.prefix), t...), true
+		}
+	}
+	return nil, false
+}
+
+func (t urlTemplate) hasParam(name string) bool {
+	for _, part := range t {
+		if part.param == name {
+			return true
+		}
+	}
+	return false
+}
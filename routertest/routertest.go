@@ -0,0 +1,305 @@
+// Conformance tests for the routers
+
+package routertest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Case is a single request in a conformance spec, along with the
+// response a router must give to it.
+type Case struct {
+	Method string
+	Path   string
+	Status int
+
+	// Body is the expected response body. It's only checked if Status
+	// is 200, as routers differ in the text of their error responses.
+	//
+	// HEAD requests are sent to the handler through a real HTTP server,
+	// as net/http itself plays a part in answering them. For these, Body
+	// is the body of the equivalent GET request: the response must have
+	// an empty body and a Content-Length of len(Body).
+	Body string
+
+	// Allow is the expected Allow header, a comma-separated list of
+	// methods compared without regard to order. It's only checked if
+	// non-empty.
+	Allow string
+}
+
+// Spec is the conformance spec for the routers in this repo, which all
+// handle the same 11 routes. It pins down which paths are served (200),
+// which are not found (404, including trailing slashes and non-numeric
+// IDs), and which match a route but not its method (405), along with
+// the full set of methods allowed for the latter. GET routes must also
+// answer HEAD requests.
+var Spec = []Case{
+	{"GET", "/", 200, "home\n", ""},
+	{"POST", "/", 405, "", "GET, HEAD"},
+	{"HEAD", "/", 200, "home\n", ""},
+
+	{"GET", "/contact", 200, "contact\n", ""},
+	{"POST", "/contact", 405, "", "GET, HEAD"},
+	{"GET", "/contact/", 404, "", ""},
+	{"GET", "/contact/no", 404, "", ""},
+	{"HEAD", "/contact", 200, "contact\n", ""},
+	{"HEAD", "/contact/", 404, "", ""},
+
+	{"GET", "/api/widgets", 200, "apiGetWidgets\n", ""},
+	{"GET", "/api/widgets/", 404, "", ""},
+	{"HEAD", "/api/widgets", 200, "apiGetWidgets\n", ""},
+
+	{"POST", "/api/widgets", 200, "apiCreateWidget\n", ""},
+	{"PUT", "/api/widgets", 405, "", "GET, HEAD, POST"},
+	{"POST", "/api/widgets/", 404, "", ""},
+
+	{"POST", "/api/widgets/foo", 200, "apiUpdateWidget foo\n", ""},
+	{"POST", "/api/widgets/bar-baz", 200, "apiUpdateWidget bar-baz\n", ""},
+	{"POST", "/api/widgets/foo/", 404, "", ""},
+	{"GET", "/api/widgets/foo", 405, "", "POST"},
+	{"HEAD", "/api/widgets/foo", 405, "", "POST"},
+
+	{"POST", "/api/widgets/foo/parts", 200, "apiCreateWidgetPart foo\n", ""},
+	{"POST", "/api/widgets/bar-baz/parts", 200, "apiCreateWidgetPart bar-baz\n", ""},
+	{"POST", "/api/widgets/foo/parts/", 404, "", ""},
+	{"GET", "/api/widgets/foo/parts", 405, "", "POST"},
+	{"POST", "/api/widgets/foo/zarts", 404, "", ""},
+
+	{"POST", "/api/widgets/foo/parts/1/update", 200, "apiUpdateWidgetPart foo 1\n", ""},
+	{"POST", "/api/widgets/foo/parts/1/update/no", 404, "", ""},
+	{"POST", "/api/widgets/foo/parts/42/update", 200, "apiUpdateWidgetPart foo 42\n", ""},
+	{"POST", "/api/widgets/foo/parts/bar/update", 404, "", ""},
+	{"POST", "/api/widgets/bar-baz/parts/99/update", 200, "apiUpdateWidgetPart bar-baz 99\n", ""},
+	{"GET", "/api/widgets/foo/parts/1/update", 405, "", "POST"},
+	{"POST", "/api/widgets/foo/parts/007/update", 200, "apiUpdateWidgetPart foo 7\n", ""},
+	{"POST", "/api/widgets/foo/parts/99999999999999999999/update", 404, "", ""},
+	{"GET", "/api/widgets/foo/parts/99999999999999999999/update", 405, "", "POST"},
+
+	{"POST", "/api/widgets/foo/parts/1/delete", 200, "apiDeleteWidgetPart foo 1\n", ""},
+	{"POST", "/api/widgets/foo/parts/1/delete/no", 404, "", ""},
+	{"POST", "/api/widgets/foo/parts/42/delete", 200, "apiDeleteWidgetPart foo 42\n", ""},
+	{"POST", "/api/widgets/foo/parts/bar/delete", 404, "", ""},
+	{"POST", "/api/widgets/bar-baz/parts/99/delete", 200, "apiDeleteWidgetPart bar-baz 99\n", ""},
+	{"GET", "/api/widgets/foo/parts/1/delete", 405, "", "POST"},
+	{"POST", "/api/widgets/foo/parts/1/no", 404, "", ""},
+
+	{"GET", "/foo", 200, "widget foo\n", ""},
+	{"GET", "/bar-baz", 200, "widget bar-baz\n", ""},
+	{"GET", "/foo/", 404, "", ""},
+	{"POST", "/foo", 405, "", "GET, HEAD"},
+	{"HEAD", "/foo", 200, "widget foo\n", ""},
+	{"HEAD", "/foo/", 404, "", ""},
+
+	{"GET", "/foo/admin", 200, "widgetAdmin foo\n", ""},
+	{"GET", "/bar-baz/admin", 200, "widgetAdmin bar-baz\n", ""},
+	{"GET", "/foo/admin/", 404, "", ""},
+	{"GET", "/foo/admin/no", 404, "", ""},
+	{"POST", "/foo/admin", 405, "", "GET, HEAD"},
+	{"HEAD", "/bar-baz/admin", 200, "widgetAdmin bar-baz\n", ""},
+
+	{"POST", "/foo/image", 200, "widgetImage foo\n", ""},
+	{"POST", "/foo/image/no", 404, "", ""},
+	{"GET", "/foo/image", 405, "", "POST"},
+	{"POST", "/bar-baz/image", 200, "widgetImage bar-baz\n", ""},
+	{"POST", "/foo/image/", 404, "", ""},
+	{"GET", "/foo/image", 405, "", "POST"},
+	{"GET", "/foo/no", 404, "", ""},
+	{"HEAD", "/foo/image", 405, "", "POST"},
+}
+
+// CatchAllSpec is the conformance spec for a route with a wildcard that
+// matches the rest of the path, "GET /files/<rest>", whose handler must
+// respond with the body "files: <rest>\n". The rest may be empty, and
+// keeps any trailing slash, but a path that isn't clean (see path.Clean)
+// is not found rather than cleaned or redirected, so the rest can't
+// climb out of /files/ and each file has one path. Use Prefix to test a
+// route under another directory, such as "/api/files/<rest>".
+var CatchAllSpec = []Case{
+	{"GET", "/files/", 200, "files: \n", ""},
+	{"GET", "/files/a.txt", 200, "files: a.txt\n", ""},
+	{"GET", "/files/a/b/c.txt", 200, "files: a/b/c.txt\n", ""},
+	{"GET", "/files/a/b/", 200, "files: a/b/\n", ""},
+	{"GET", "/files/.hidden/...", 200, "files: .hidden/...\n", ""},
+	{"HEAD", "/files/a/b", 200, "files: a/b\n", ""},
+	{"GET", "/files", 404, "", ""},
+	{"GET", "/filesx/a", 404, "", ""},
+	{"GET", "/files//", 404, "", ""},
+	{"GET", "/files/a//b", 404, "", ""},
+	{"GET", "/files/a/./b", 404, "", ""},
+	{"GET", "/files/a/../b", 404, "", ""},
+	{"GET", "/files/..", 404, "", ""},
+	{"GET", "/files/../", 404, "", ""},
+	{"POST", "/files/a", 405, "", "GET, HEAD"},
+}
+
+// Run runs every case in Spec against handler, each as a subtest of t.
+func Run(t *testing.T, handler http.Handler) {
+	RunCases(t, handler, Spec)
+}
+
+// IgnoreAllow returns a copy of cases without the Allow expectations,
+// for testing routers that don't list every allowed method in Allow.
+func IgnoreAllow(cases []Case) []Case {
+	ignored := make([]Case, len(cases))
+	for i, c := range cases {
+		c.Allow = ""
+		ignored[i] = c
+	}
+	return ignored
+}
+
+// Prefix returns a copy of cases with prefix added to the start of each
+// path, for testing routes under prefix.
+func Prefix(prefix string, cases []Case) []Case {
+	prefixed := make([]Case, len(cases))
+	for i, c := range cases {
+		c.Path = prefix + c.Path
+		prefixed[i] = c
+	}
+	return prefixed
+}
+
+// RunCases is like Run, but runs the given cases instead of Spec.
+func RunCases(t *testing.T, handler http.Handler, cases []Case) {
+	t.Helper()
+	var server *httptest.Server
+	defer func() {
+		if server != nil {
+			server.Close()
+		}
+	}()
+	for _, c := range cases {
+		name := c.Method + strings.ReplaceAll(c.Path, "/", "_")
+		t.Run(name, func(t *testing.T) {
+			var got response
+			var err error
+			if c.Method == "HEAD" {
+				if server == nil {
+					server = httptest.NewServer(handler)
+				}
+				got, err = serveHEAD(server, c.Path)
+			} else {
+				got, err = serveRecorded(handler, c.Method, c.Path)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !c.matches(got) {
+				t.Fatalf("%s %s\n got: %s\nwant: %s", c.Method, c.Path, c.format(got), c.want())
+			}
+		})
+	}
+}
+
+// response is the part of a router's response that a Case checks.
+type response struct {
+	status int
+	body   string
+	length int64 // Content-Length, only used for HEAD requests
+	allow  string
+}
+
+// serveRecorded serves a request directly using a ResponseRecorder.
+func serveRecorded(handler http.Handler, method, path string) (response, error) {
+	request, err := http.NewRequest(method, path, &bytes.Buffer{})
+	if err != nil {
+		return response{}, err
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return response{
+		status: recorder.Code,
+		body:   recorder.Body.String(),
+		allow:  recorder.Header().Get("Allow"),
+	}, nil
+}
+
+// serveHEAD serves a HEAD request through server, as net/http itself
+// plays a part in how HEAD requests are answered.
+func serveHEAD(server *httptest.Server, path string) (response, error) {
+	resp, err := server.Client().Head(server.URL + path)
+	if err != nil {
+		return response{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return response{}, err
+	}
+	return response{
+		status: resp.StatusCode,
+		body:   string(body),
+		length: resp.ContentLength,
+		allow:  resp.Header.Get("Allow"),
+	}, nil
+}
+
+// matches reports whether got is the response c expects.
+func (c Case) matches(got response) bool {
+	if got.status != c.Status {
+		return false
+	}
+	if c.Status == 200 {
+		if c.Method == "HEAD" && (got.body != "" || got.length != int64(len(c.Body))) {
+			return false
+		}
+		if c.Method != "HEAD" && got.body != c.Body {
+			return false
+		}
+	}
+	return c.Allow == "" || sameMethods(got.allow, c.Allow)
+}
+
+// sameMethods reports whether the comma-separated method lists a and b
+// contain the same set of methods.
+func sameMethods(a, b string) bool {
+	return methodSet(a) == methodSet(b)
+}
+
+func methodSet(list string) string {
+	var methods []string
+	for _, m := range strings.Split(list, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			methods = append(methods, m)
+		}
+	}
+	slices.Sort(methods)
+	return strings.Join(slices.Compact(methods), ", ")
+}
+
+// format formats the response got for a failure message.
+func (c Case) format(got response) string {
+	s := fmt.Sprintf("%d %q", got.status, got.body)
+	if c.Method == "HEAD" {
+		s += fmt.Sprintf(" Content-Length: %d", got.length)
+	}
+	if c.Allow != "" {
+		s += fmt.Sprintf(" Allow: %q", got.allow)
+	}
+	return s
+}
+
+// want formats the response c expects, in the same format as format.
+func (c Case) want() string {
+	var s string
+	switch {
+	case c.Status != 200:
+		s = fmt.Sprintf("%d (any body)", c.Status)
+	case c.Method == "HEAD":
+		s = fmt.Sprintf("%d \"\" Content-Length: %d", c.Status, len(c.Body))
+	default:
+		s = fmt.Sprintf("%d %q", c.Status, c.Body)
+	}
+	if c.Allow != "" {
+		s += fmt.Sprintf(" Allow: %q", c.Allow)
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+// List the routes registered with a router
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/benhoyt/go-routing/chi"
+	"github.com/benhoyt/go-routing/gorilla"
+	"github.com/benhoyt/go-routing/introspect"
+	"github.com/benhoyt/go-routing/match"
+	"github.com/benhoyt/go-routing/pat"
+	"github.com/benhoyt/go-routing/reswitch"
+	"github.com/benhoyt/go-routing/retable"
+	"github.com/benhoyt/go-routing/stdlib"
+	"github.com/benhoyt/go-routing/trie"
+)
+
+// routeLists has a function that lists the registered routes for each
+// router that supports it.
+var routeLists = map[string]func() []introspect.RouteInfo{
+	"chi":      chi.Routes,
+	"gorilla":  gorilla.Routes,
+	"match":    match.Routes,
+	"pat":      pat.Routes,
+	"reswitch": reswitch.Routes,
+	"retable":  retable.Serve.Routes,
+	"stdlib":   stdlib.Routes,
+	"trie":     trie.Serve.Routes,
+}
+
+// runRoutes implements the "routes" subcommand, which prints a table of
+// the routes registered with a router.
+func runRoutes(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("routes", flag.ExitOnError)
+	flags.Usage = func() {
+		var names []string
+		for name := range routeLists {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(flags.Output(), "usage: go-routing routes router\n\n")
+		fmt.Fprintf(flags.Output(), "Print the routes registered with router, which is one of: %s\n",
+			strings.Join(names, ", "))
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected a router name")
+	}
+	name := flags.Arg(0)
+	routes := routeLists[name]
+	if routes == nil {
+		if routers[name] != nil {
+			return fmt.Errorf("router %q can't list its routes", name)
+		}
+		return fmt.Errorf("unknown router %q", name)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "METHOD\tPATTERN\tHANDLER\n")
+	for _, route := range routes() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", route.Method, route.Pattern, route.Handler)
+	}
+	return tw.Flush()
+}
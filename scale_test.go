@@ -0,0 +1,196 @@
+// Benchmark the routers against generated route tables of various sizes
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bmizerany/pat"
+	"github.com/go-chi/chi"
+	"github.com/gorilla/mux"
+
+	"github.com/benhoyt/go-routing/retable"
+	"github.com/benhoyt/go-routing/trie"
+)
+
+var routeTableSizes = flag.String("routes", "10,100,1000,10000",
+	"comma-separated route table sizes for BenchmarkRouteTables")
+
+// genRoute is a generated route: a method and a list of path segments,
+// each of which is either a literal or a named parameter.
+type genRoute struct {
+	method   string
+	segments []genSegment
+}
+
+type genSegment struct {
+	literal string
+	param   string // parameter name if this is a parameter segment
+}
+
+func lit(s string) genSegment   { return genSegment{literal: s} }
+func param(s string) genSegment { return genSegment{param: s} }
+
+// pattern formats the route's path as a pattern, calling format to
+// produce the text for each parameter segment.
+func (r genRoute) pattern(format func(name string) string) string {
+	var sb strings.Builder
+	for _, s := range r.segments {
+		sb.WriteByte('/')
+		if s.param != "" {
+			sb.WriteString(format(s.param))
+		} else {
+			sb.WriteString(s.literal)
+		}
+	}
+	return sb.String()
+}
+
+// path returns a concrete request path that matches the route.
+func (r genRoute) path() string {
+	return r.pattern(func(name string) string { return "v-" + name })
+}
+
+// routeShapes are the kinds of route table we generate. Every route
+// starts with or contains a unique literal, so that no two routes in a
+// table conflict (the stdlib ServeMux panics on conflicting patterns).
+var routeShapes = []struct {
+	name     string
+	generate func(i int) genRoute
+}{
+	{"static", func(i int) genRoute {
+		// /static/g3/r50
+		return genRoute{"GET", []genSegment{
+			lit("static"), lit("g" + strconv.Itoa(i/16)), lit("r" + strconv.Itoa(i)),
+		}}
+	}},
+	{"params", func(i int) genRoute {
+		// /p50/{a}/items/{b}
+		return genRoute{"GET", []genSegment{
+			lit("p" + strconv.Itoa(i)), param("a"), lit("items"), param("b"),
+		}}
+	}},
+	{"deep", func(i int) genRoute {
+		// /deep/l2/m50/{a}/n50/{b}/leaf
+		return genRoute{"GET", []genSegment{
+			lit("deep"), lit("l" + strconv.Itoa(i%8)), lit("m" + strconv.Itoa(i%64)),
+			param("a"), lit("n" + strconv.Itoa(i)), param("b"), lit("leaf"),
+		}}
+	}},
+}
+
+// tableRouters are the routers that support dynamic registration, each
+// with a function that builds one from a list of generated routes.
+var tableRouters = []struct {
+	name  string
+	build func(routes []genRoute, h http.HandlerFunc) http.Handler
+}{
+	{"chi", func(routes []genRoute, h http.HandlerFunc) http.Handler {
+		r := chi.NewRouter()
+		for _, route := range routes {
+			r.Method(route.method, route.pattern(func(name string) string {
+				return "{" + name + "}"
+			}), h)
+		}
+		return r
+	}},
+	{"gorilla", func(routes []genRoute, h http.HandlerFunc) http.Handler {
+		r := mux.NewRouter()
+		for _, route := range routes {
+			r.HandleFunc(route.pattern(func(name string) string {
+				return "{" + name + "}"
+			}), h).Methods(route.method)
+		}
+		return r
+	}},
+	{"pat", func(routes []genRoute, h http.HandlerFunc) http.Handler {
+		r := pat.New()
+		for _, route := range routes {
+			r.Add(route.method, route.pattern(func(name string) string {
+				return ":" + name
+			}), h)
+		}
+		return r
+	}},
+	{"retable", func(routes []genRoute, h http.HandlerFunc) http.Handler {
+		r := retable.NewRouter()
+		for _, route := range routes {
+			r.Handle(route.method, route.pattern(func(name string) string {
+				return "(?P<" + name + ">[^/]+)"
+			}), h)
+		}
+		return r
+	}},
+	{"stdlib", func(routes []genRoute, h http.HandlerFunc) http.Handler {
+		r := http.NewServeMux()
+		for _, route := range routes {
+			r.HandleFunc(route.method+" "+route.pattern(func(name string) string {
+				return "{" + name + "}"
+			}), h)
+		}
+		return r
+	}},
+	{"trie", func(routes []genRoute, h http.HandlerFunc) http.Handler {
+		r := trie.NewRouter()
+		for _, route := range routes {
+			r.Handle(route.method, route.pattern(func(name string) string {
+				return ":" + name
+			}), h)
+		}
+		return r
+	}},
+}
+
+// BenchmarkRouteTables times each dynamically-registered router against
+// generated route tables of each shape and size (set the sizes with the
+// -routes flag). The request path matches the last route registered,
+// which is the worst case for the routers that scan routes linearly.
+func BenchmarkRouteTables(b *testing.B) {
+	var sizes []int
+	for _, s := range strings.Split(*routeTableSizes, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || size <= 0 {
+			b.Fatalf("invalid -routes size %q", s)
+		}
+		sizes = append(sizes, size)
+	}
+
+	for _, shape := range routeShapes {
+		for _, size := range sizes {
+			for _, router := range tableRouters {
+				name := fmt.Sprintf("%s/%d/%s", shape.name, size, router.name)
+				b.Run(name, func(b *testing.B) {
+					routes := make([]genRoute, size)
+					for i := range routes {
+						routes[i] = shape.generate(i)
+					}
+					matched := false
+					handler := router.build(routes, func(w http.ResponseWriter, r *http.Request) {
+						matched = true
+					})
+					last := routes[len(routes)-1]
+					template, err := http.NewRequest(last.method, last.path(), nil)
+					if err != nil {
+						b.Fatal(err)
+					}
+					responseWriter := &noopResponseWriter{}
+
+					b.ReportAllocs()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						handler.ServeHTTP(responseWriter, copyRequest(template))
+					}
+					b.StopTimer()
+					if !matched {
+						b.Fatalf("%s %s didn't match", last.method, last.path())
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Serve a router with configurable limits and graceful shutdown
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// serverConfig is the configuration of the HTTP server, set from
+// command line flags or environment variables (see addFlags).
+type serverConfig struct {
+	addr            string
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	idleTimeout     time.Duration
+	maxHeaderBytes  int
+	shutdownTimeout time.Duration
+	strict          bool
+}
+
+// addFlags defines a flag for each field of c on flags. Each flag's
+// default comes from the environment variable named alongside it, if
+// that's set, so flags take precedence over environment variables. Call
+// the returned function after parsing the flags: it reports any
+// environment variable that couldn't be parsed, unless its flag was set.
+func (c *serverConfig) addFlags(flags *flag.FlagSet) (checkEnv func() error) {
+	envErrs := make(map[string]error) // by flag name
+	lookup := func(flagName string) (string, bool) {
+		return os.LookupEnv(envName(flagName))
+	}
+	envString := func(flagName, def string) string {
+		if s, ok := lookup(flagName); ok {
+			return s
+		}
+		return def
+	}
+	envDuration := func(flagName string, def time.Duration) time.Duration {
+		s, ok := lookup(flagName)
+		if !ok {
+			return def
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			envErrs[flagName] = fmt.Errorf("invalid %s: %w", envName(flagName), err)
+		}
+		return d
+	}
+	envBool := func(flagName string, def bool) bool {
+		s, ok := lookup(flagName)
+		if !ok {
+			return def
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			envErrs[flagName] = fmt.Errorf("invalid %s: %w", envName(flagName), err)
+		}
+		return b
+	}
+	envInt := func(flagName string, def int) int {
+		s, ok := lookup(flagName)
+		if !ok {
+			return def
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			envErrs[flagName] = fmt.Errorf("invalid %s: %w", envName(flagName), err)
+		}
+		return n
+	}
+
+	flags.StringVar(&c.addr, "addr", envString("addr", ":8080"),
+		"`address` to listen on (env ROUTING_ADDR)")
+	flags.DurationVar(&c.readTimeout, "read-timeout", envDuration("read-timeout", 10*time.Second),
+		"maximum time to read a request, including the body (env ROUTING_READ_TIMEOUT)")
+	flags.DurationVar(&c.writeTimeout, "write-timeout", envDuration("write-timeout", 10*time.Second),
+		"maximum time to write a response (env ROUTING_WRITE_TIMEOUT)")
+	flags.DurationVar(&c.idleTimeout, "idle-timeout", envDuration("idle-timeout", 60*time.Second),
+		"maximum time to wait for the next request on a keep-alive connection (env ROUTING_IDLE_TIMEOUT)")
+	flags.IntVar(&c.maxHeaderBytes, "max-header-bytes", envInt("max-header-bytes", http.DefaultMaxHeaderBytes),
+		"maximum size of request headers in `bytes` (env ROUTING_MAX_HEADER_BYTES)")
+	flags.DurationVar(&c.shutdownTimeout, "shutdown-timeout", envDuration("shutdown-timeout", 10*time.Second),
+		"maximum time to wait for in-flight requests on shutdown (env ROUTING_SHUTDOWN_TIMEOUT)")
+	flags.BoolVar(&c.strict, "strict", envBool("strict", false),
+		"refuse to start if the router has unreachable or ambiguous routes, see \"go-routing lint\" (routers it can't check are started anyway) (env ROUTING_STRICT)")
+
+	return func() error {
+		flags.Visit(func(f *flag.Flag) {
+			delete(envErrs, f.Name)
+		})
+		var errs []error
+		flags.VisitAll(func(f *flag.Flag) { // in a consistent order
+			if err := envErrs[f.Name]; err != nil {
+				errs = append(errs, err)
+			}
+		})
+		return errors.Join(errs...)
+	}
+}
+
+// envName returns the name of the environment variable for the server
+// flag with the given name, for example ROUTING_READ_TIMEOUT for
+// "read-timeout".
+func envName(flagName string) string {
+	return "ROUTING_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// serve serves router with the given config until ctx is canceled or a
+// SIGINT or SIGTERM is received. It then shuts the server down
+// gracefully, waiting up to config.shutdownTimeout for in-flight
+// requests to complete, and a second signal stops it immediately.
+//
+// In strict mode, serve first checks the router's routes, and returns an
+// error without serving if it finds any problems. Only some routers'
+// routes can be checked (see linters): others are served anyway, with a
+// warning logged.
+func serve(ctx context.Context, config serverConfig, routerName string, router http.Handler) error {
+	if config.strict && linters[routerName] == nil {
+		log.Printf("strict mode: %s router's routes can't be checked, serving without checking them", routerName)
+	} else if config.strict {
+		problems, err := lintRouter(routerName)
+		if err != nil {
+			return fmt.Errorf("strict mode: %w", err)
+		}
+		if len(problems) > 0 {
+			var errs []error
+			for _, problem := range problems {
+				errs = append(errs, errors.New(problem.String()))
+			}
+			return fmt.Errorf("strict mode: %w", errors.Join(errs...))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	listener, err := net.Listen("tcp", config.addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler:        router,
+		ReadTimeout:    config.readTimeout,
+		WriteTimeout:   config.writeTimeout,
+		IdleTimeout:    config.idleTimeout,
+		MaxHeaderBytes: config.maxHeaderBytes,
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.Serve(listener)
+	}()
+	log.Printf("listening on %s using %s router", listener.Addr(), routerName)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	stop() // stop handling signals, so a second one kills the process
+
+	log.Printf("shutting down, waiting up to %s for requests to finish", config.shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestServerFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want serverConfig
+		err  string
+	}{{
+		name: "defaults",
+		want: serverConfig{addr: ":8080", readTimeout: 10 * time.Second, writeTimeout: 10 * time.Second,
+			idleTimeout: 60 * time.Second, maxHeaderBytes: http.DefaultMaxHeaderBytes, shutdownTimeout: 10 * time.Second},
+	}, {
+		name: "env",
+		env:  map[string]string{"ROUTING_ADDR": ":1234", "ROUTING_READ_TIMEOUT": "1s", "ROUTING_MAX_HEADER_BYTES": "100", "ROUTING_STRICT": "true"},
+		want: serverConfig{addr: ":1234", readTimeout: time.Second, writeTimeout: 10 * time.Second,
+			idleTimeout: 60 * time.Second, maxHeaderBytes: 100, shutdownTimeout: 10 * time.Second, strict: true},
+	}, {
+		name: "flags override env",
+		env:  map[string]string{"ROUTING_ADDR": ":1234", "ROUTING_READ_TIMEOUT": "1s", "ROUTING_STRICT": "true"},
+		args: []string{"-addr", ":5678", "-read-timeout", "2s", "-strict=false"},
+		want: serverConfig{addr: ":5678", readTimeout: 2 * time.Second, writeTimeout: 10 * time.Second,
+			idleTimeout: 60 * time.Second, maxHeaderBytes: http.DefaultMaxHeaderBytes, shutdownTimeout: 10 * time.Second},
+	}, {
+		name: "invalid env",
+		env:  map[string]string{"ROUTING_STRICT": "maybe", "ROUTING_IDLE_TIMEOUT": "1", "ROUTING_MAX_HEADER_BYTES": "lots"},
+		err:  "invalid ROUTING_IDLE_TIMEOUT: " + `time: missing unit in duration "1"` + "\n" + "invalid ROUTING_MAX_HEADER_BYTES: " + `strconv.Atoi: parsing "lots": invalid syntax` + "\n" + "invalid ROUTING_STRICT: " + `strconv.ParseBool: parsing "maybe": invalid syntax`,
+	}, {
+		name: "invalid env overridden by flags",
+		env:  map[string]string{"ROUTING_STRICT": "maybe", "ROUTING_IDLE_TIMEOUT": "1"},
+		args: []string{"-strict", "-idle-timeout", "1s"},
+		want: serverConfig{addr: ":8080", readTimeout: 10 * time.Second, writeTimeout: 10 * time.Second,
+			idleTimeout: time.Second, maxHeaderBytes: http.DefaultMaxHeaderBytes, shutdownTimeout: 10 * time.Second, strict: true},
+	}, {
+		name: "invalid env partly overridden",
+		env:  map[string]string{"ROUTING_STRICT": "maybe", "ROUTING_IDLE_TIMEOUT": "1"},
+		args: []string{"-strict"},
+		err:  "invalid ROUTING_IDLE_TIMEOUT: " + `time: missing unit in duration "1"`,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, flagName := range []string{"addr", "read-timeout", "write-timeout",
+				"idle-timeout", "max-header-bytes", "shutdown-timeout", "strict"} {
+				name := envName(flagName)
+				t.Setenv(name, test.env[name]) // restored after the test
+				if _, ok := test.env[name]; !ok {
+					os.Unsetenv(name)
+				}
+			}
+
+			var config serverConfig
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			checkEnv := config.addFlags(flags)
+			if err := flags.Parse(test.args); err != nil {
+				t.Fatal(err)
+			}
+			err := checkEnv()
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("got error %v, want:\n%s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config != test.want {
+				t.Fatalf("got config %+v, want %+v", config, test.want)
+			}
+		})
+	}
+}
+
+// TestGracefulShutdown checks that canceling serve's context lets an
+// in-flight request finish before serve returns, and that serve gives up
+// on one that takes longer than the shutdown timeout.
+func TestGracefulShutdown(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		timeout time.Duration
+		err     string
+	}{
+		{"in time", 10 * time.Second, ""},
+		{"timed out", 50 * time.Millisecond, "shutting down: context deadline exceeded"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			started := make(chan struct{})
+			release := make(chan struct{})
+			router := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				<-release
+				io.WriteString(w, "done\n")
+			})
+			defer close(release)
+
+			addr := freeAddr(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			config := serverConfig{addr: addr, shutdownTimeout: test.timeout}
+			served := make(chan error, 1)
+			go func() {
+				served <- serve(ctx, config, "test", router)
+			}()
+
+			type response struct {
+				body string
+				err  error
+			}
+			responses := make(chan response, 1)
+			go func() {
+				resp, err := getWhenListening("http://" + addr + "/")
+				if err != nil {
+					responses <- response{err: err}
+					return
+				}
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+				responses <- response{string(body), err}
+			}()
+
+			select {
+			case <-started:
+			case err := <-served:
+				t.Fatalf("serve returned before handling the request: %v", err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("request wasn't handled")
+			}
+			cancel()
+
+			if test.err != "" {
+				err := <-served
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			select {
+			case err := <-served:
+				t.Fatalf("serve returned with a request in flight: %v", err)
+			case <-time.After(50 * time.Millisecond):
+			}
+			release <- struct{}{}
+			if resp := <-responses; resp.err != nil || resp.body != "done\n" {
+				t.Fatalf("got response %q, %v, want \"done\\n\"", resp.body, resp.err)
+			}
+			if err := <-served; err != nil {
+				t.Fatalf("got error %v, want nil", err)
+			}
+		})
+	}
+}
+
+// freeAddr returns a local address that nothing is listening on.
+func freeAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// getWhenListening sends a GET request to url, retrying for a while if
+// the server isn't listening yet.
+func getWhenListening(url string) (*http.Response, error) {
+	for i := 0; ; i++ {
+		resp, err := http.Get(url)
+		var opErr *net.OpError
+		if err == nil || i == 100 || !errors.As(err, &opErr) || opErr.Op != "dial" {
+			return resp, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
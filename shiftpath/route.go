@@ -4,16 +4,43 @@
 package shiftpath
 
 import (
-	"fmt"
 	"net/http"
 	"path"
-	"strconv"
 	"strings"
+
+	"github.com/benhoyt/go-routing/internal/autohead"
+	"github.com/benhoyt/go-routing/internal/middleware"
+	"github.com/benhoyt/go-routing/widgets"
 )
 
-var Serve = noTrailingSlash(serve)
+var handlers = widgets.Default
+
+var stack = middleware.NewStack(dispatch)
+
+// Use adds middleware that wraps every request, with the first
+// outermost. It runs before any of the path is shifted, so it sees the
+// original r.URL.Path.
+func Use(mw ...func(http.Handler) http.Handler) {
+	stack.Use(mw...)
+}
+
+func Serve(w http.ResponseWriter, r *http.Request) {
+	stack.ServeHTTP(w, r)
+}
+
+var dispatch = noTrailingSlash(serve)
 
 func serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "HEAD" {
+		// Serve HEAD requests as if they were GETs (ensureMethod allows
+		// this), discarding the response body
+		autohead.Serve(w, r, http.HandlerFunc(route))
+		return
+	}
+	route(w, r)
+}
+
+func route(w http.ResponseWriter, r *http.Request) {
 	var head string
 	head, r.URL.Path = shiftPath(r.URL.Path)
 	switch head {
@@ -24,7 +51,8 @@ func serve(w http.ResponseWriter, r *http.Request) {
 	case "contact":
 		serveContact(w, r)
 	default:
-		widget{head}.ServeHTTP(w, r)
+		r.SetPathValue("slug", head)
+		serveWidget(w, r)
 	}
 }
 
@@ -40,11 +68,19 @@ func shiftPath(p string) (head, tail string) {
 }
 
 // ensureMethod is a helper that reports whether the request's method is
-// the given method, writing an Allow header and a 405 Method Not Allowed
-// if not. The caller should return from the handler if this returns false.
+// the given method (or HEAD, if the given method is GET), writing an
+// Allow header and a 405 Method Not Allowed if not. The caller should
+// return from the handler if this returns false.
 func ensureMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if method == "GET" && r.Method == "HEAD" {
+		return true
+	}
 	if method != r.Method {
-		w.Header().Set("Allow", method)
+		allow := method
+		if method == "GET" {
+			allow += ", HEAD"
+		}
+		w.Header().Set("Allow", allow)
 		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
 		return false
 	}
@@ -70,31 +106,32 @@ func serveHome(w http.ResponseWriter, r *http.Request) {
 	if !ensureMethod(w, r, "GET") {
 		return
 	}
-	fmt.Fprint(w, "home\n")
+	handlers.Home(w, r)
 }
 
 func serveContact(w http.ResponseWriter, r *http.Request) {
-	var head string
-	head, r.URL.Path = shiftPath(r.URL.Path)
-	if head != "" {
-		http.NotFound(w, r)
+	if r.URL.Path != "/" {
+		// Not /contact itself, so it's a widget named "contact"
+		r.SetPathValue("slug", "contact")
+		serveWidget(w, r)
 		return
 	}
 	if !ensureMethod(w, r, "GET") {
 		return
 	}
-	fmt.Fprint(w, "contact\n")
+	handlers.Contact(w, r)
 }
 
 func serveApi(w http.ResponseWriter, r *http.Request) {
-	var head string
-	head, r.URL.Path = shiftPath(r.URL.Path)
-	switch head {
-	case "widgets":
-		serveApiWidgets(w, r)
-	default:
-		http.NotFound(w, r)
+	head, tail := shiftPath(r.URL.Path)
+	if head != "widgets" {
+		// Not an API route, so it's a widget named "api"
+		r.SetPathValue("slug", "api")
+		serveWidget(w, r)
+		return
 	}
+	r.URL.Path = tail
+	serveApiWidgets(w, r)
 }
 
 func serveApiWidgets(w http.ResponseWriter, r *http.Request) {
@@ -102,13 +139,14 @@ func serveApiWidgets(w http.ResponseWriter, r *http.Request) {
 	head, r.URL.Path = shiftPath(r.URL.Path)
 	switch head {
 	case "":
-		if r.Method == "GET" {
+		if r.Method == "GET" || r.Method == "HEAD" {
 			serveApiGetWidgets(w, r)
 		} else {
 			serveApiCreateWidget(w, r)
 		}
 	default:
-		apiWidget{head}.ServeHTTP(w, r)
+		r.SetPathValue("slug", head)
+		serveApiWidget(w, r)
 	}
 }
 
@@ -116,155 +154,106 @@ func serveApiGetWidgets(w http.ResponseWriter, r *http.Request) {
 	if !ensureMethod(w, r, "GET") {
 		return
 	}
-	fmt.Fprint(w, "apiGetWidgets\n")
+	handlers.GetWidgets(w, r)
 }
 
 func serveApiCreateWidget(w http.ResponseWriter, r *http.Request) {
 	if !ensureMethod(w, r, "POST") {
 		return
 	}
-	fmt.Fprint(w, "apiCreateWidget\n")
-}
-
-type apiWidget struct {
-	slug string
+	handlers.CreateWidget(w, r)
 }
 
-func (h apiWidget) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func serveApiWidget(w http.ResponseWriter, r *http.Request) {
 	var head string
 	head, r.URL.Path = shiftPath(r.URL.Path)
 	switch head {
 	case "":
-		h.serveUpdate(w, r)
+		serveApiUpdateWidget(w, r)
 	case "parts":
-		h.serveParts(w, r)
+		serveApiWidgetParts(w, r)
 	default:
 		http.NotFound(w, r)
 	}
 }
 
-func (h apiWidget) serveUpdate(w http.ResponseWriter, r *http.Request) {
+func serveApiUpdateWidget(w http.ResponseWriter, r *http.Request) {
 	if !ensureMethod(w, r, "POST") {
 		return
 	}
-	fmt.Fprintf(w, "apiUpdateWidget %s\n", h.slug)
+	handlers.UpdateWidget(w, r)
 }
 
-func (h apiWidget) serveParts(w http.ResponseWriter, r *http.Request) {
+func serveApiWidgetParts(w http.ResponseWriter, r *http.Request) {
 	var head string
 	head, r.URL.Path = shiftPath(r.URL.Path)
 	switch head {
 	case "":
-		h.serveCreatePart(w, r)
+		serveApiCreateWidgetPart(w, r)
 	default:
-		id, err := strconv.Atoi(head)
-		if err != nil || id <= 0 {
+		if !widgets.IsID(head) {
 			http.NotFound(w, r)
 			return
 		}
-		apiWidgetPart{h.slug, id}.ServeHTTP(w, r)
+		r.SetPathValue("id", head)
+		serveApiWidgetPart(w, r)
 	}
 }
 
-func (h apiWidget) serveCreatePart(w http.ResponseWriter, r *http.Request) {
+func serveApiCreateWidgetPart(w http.ResponseWriter, r *http.Request) {
 	if !ensureMethod(w, r, "POST") {
 		return
 	}
-	fmt.Fprintf(w, "apiCreateWidgetPart %s\n", h.slug)
-}
-
-type apiWidgetPart struct {
-	slug string
-	id   int
+	handlers.CreateWidgetPart(w, r)
 }
 
-func (h apiWidgetPart) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func serveApiWidgetPart(w http.ResponseWriter, r *http.Request) {
 	var head string
 	head, r.URL.Path = shiftPath(r.URL.Path)
 	switch head {
 	case "update":
-		h.serveUpdate(w, r)
+		serveEnd(w, r, "POST", handlers.UpdateWidgetPart)
 	case "delete":
-		h.serveDelete(w, r)
+		serveEnd(w, r, "POST", handlers.DeleteWidgetPart)
 	default:
 		http.NotFound(w, r)
 	}
 }
 
-func (h apiWidgetPart) serveUpdate(w http.ResponseWriter, r *http.Request) {
-	var head string
-	head, r.URL.Path = shiftPath(r.URL.Path)
-	if head != "" {
-		http.NotFound(w, r)
-		return
-	}
-	if !ensureMethod(w, r, "POST") {
-		return
-	}
-	fmt.Fprintf(w, "apiUpdateWidgetPart %s %d\n", h.slug, h.id)
-}
-
-func (h apiWidgetPart) serveDelete(w http.ResponseWriter, r *http.Request) {
-	var head string
-	head, r.URL.Path = shiftPath(r.URL.Path)
-	if head != "" {
-		http.NotFound(w, r)
-		return
-	}
-	if !ensureMethod(w, r, "POST") {
-		return
-	}
-	fmt.Fprintf(w, "apiDeleteWidgetPart %s %d\n", h.slug, h.id)
-}
-
-type widget struct {
-	slug string
-}
-
-func (h widget) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func serveWidget(w http.ResponseWriter, r *http.Request) {
 	var head string
 	head, r.URL.Path = shiftPath(r.URL.Path)
 	switch head {
 	case "":
-		h.serveGet(w, r)
+		serveWidgetGet(w, r)
 	case "admin":
-		h.serveAdmin(w, r)
+		serveEnd(w, r, "GET", handlers.WidgetAdmin)
 	case "image":
-		h.serveUpdateImage(w, r)
+		serveEnd(w, r, "POST", handlers.WidgetImage)
 	default:
 		http.NotFound(w, r)
 	}
 }
 
-func (h widget) serveGet(w http.ResponseWriter, r *http.Request) {
+func serveWidgetGet(w http.ResponseWriter, r *http.Request) {
 	if !ensureMethod(w, r, "GET") {
 		return
 	}
-	fmt.Fprintf(w, "widget %s\n", h.slug)
+	handlers.Widget(w, r)
 }
 
-func (h widget) serveAdmin(w http.ResponseWriter, r *http.Request) {
+// serveEnd serves the request with h if the path has been fully shifted
+// and the method is allowed (see ensureMethod), otherwise it responds
+// with 404 Not Found or 405 Method Not Allowed.
+func serveEnd(w http.ResponseWriter, r *http.Request, method string, h http.HandlerFunc) {
 	var head string
 	head, r.URL.Path = shiftPath(r.URL.Path)
 	if head != "" {
 		http.NotFound(w, r)
 		return
 	}
-	if !ensureMethod(w, r, "GET") {
-		return
-	}
-	fmt.Fprintf(w, "widgetAdmin %s\n", h.slug)
-}
-
-func (h widget) serveUpdateImage(w http.ResponseWriter, r *http.Request) {
-	var head string
-	head, r.URL.Path = shiftPath(r.URL.Path)
-	if head != "" {
-		http.NotFound(w, r)
-		return
-	}
-	if !ensureMethod(w, r, "POST") {
+	if !ensureMethod(w, r, method) {
 		return
 	}
-	fmt.Fprintf(w, "widgetImage %s\n", h.slug)
+	h(w, r)
 }
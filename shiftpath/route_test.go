@@ -0,0 +1,42 @@
+package shiftpath
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/benhoyt/go-routing/internal/middleware"
+)
+
+func TestUse(t *testing.T) {
+	t.Cleanup(func() { stack = middleware.NewStack(dispatch) })
+	var paths []string
+	Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.Path)
+			next.ServeHTTP(w, r)
+		})
+	})
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"GET", "/foo/admin", 200},
+		{"POST", "/api/widgets/foo/parts/1/update", 200},
+		{"GET", "/api/widgets/foo/parts/1/update", 405},
+		{"GET", "/foo/admin/", 404},
+	}
+	for _, test := range tests {
+		paths = nil
+		recorder := httptest.NewRecorder()
+		Serve(recorder, httptest.NewRequest(test.method, test.path, nil))
+		if recorder.Code != test.status {
+			t.Errorf("%s %s: got status %d, want %d", test.method, test.path, recorder.Code, test.status)
+		}
+		// The middleware runs once, before the path is shifted
+		if len(paths) != 1 || paths[0] != test.path {
+			t.Errorf("%s %s: middleware saw paths %q", test.method, test.path, paths)
+		}
+	}
+}
@@ -3,43 +3,80 @@
 package split
 
 import (
-	"fmt"
 	"net/http"
-	"strconv"
+	"sort"
 	"strings"
+
+	"github.com/benhoyt/go-routing/internal/autohead"
+	"github.com/benhoyt/go-routing/internal/middleware"
+	"github.com/benhoyt/go-routing/widgets"
 )
 
+var handlers = widgets.Default
+
+var stack = middleware.NewStack(http.HandlerFunc(dispatch))
+
+// Use adds middleware around the routing of every request (404s
+// included), with the first outermost.
+func Use(mw ...func(http.Handler) http.Handler) {
+	stack.Use(mw...)
+}
+
 func Serve(w http.ResponseWriter, r *http.Request) {
+	stack.ServeHTTP(w, r)
+}
+
+// The handlers for the routes, built once rather than for every request
+var (
+	getHome              = get(handlers.Home)
+	getContact           = get(handlers.Contact)
+	apiWidgets           = methods{"GET": handlers.GetWidgets, "POST": handlers.CreateWidget}
+	postUpdateWidget     = post(handlers.UpdateWidget)
+	postCreateWidgetPart = post(handlers.CreateWidgetPart)
+	postUpdateWidgetPart = post(handlers.UpdateWidgetPart)
+	postDeleteWidgetPart = post(handlers.DeleteWidgetPart)
+	getWidget            = get(handlers.Widget)
+	getWidgetAdmin       = get(handlers.WidgetAdmin)
+	postWidgetImage      = post(handlers.WidgetImage)
+)
+
+func dispatch(w http.ResponseWriter, r *http.Request) {
 	// Split path into slash-separated parts, for example, path "/foo/bar"
 	// gives p==["foo", "bar"] and path "/" gives p==[""].
 	p := strings.Split(r.URL.Path, "/")[1:]
 	n := len(p)
 
 	var h http.Handler
-	var id int
 	switch {
 	case n == 1 && p[0] == "":
-		h = get(home)
+		h = getHome
 	case n == 1 && p[0] == "contact":
-		h = get(contact)
-	case n == 2 && p[0] == "api" && p[1] == "widgets" && r.Method == "GET":
-		h = get(apiGetWidgets)
+		h = getContact
 	case n == 2 && p[0] == "api" && p[1] == "widgets":
-		h = post(apiCreateWidget)
+		h = apiWidgets
 	case n == 3 && p[0] == "api" && p[1] == "widgets" && p[2] != "":
-		h = post(apiWidget{p[2]}.update)
+		h = postUpdateWidget
+		r.SetPathValue("slug", p[2])
 	case n == 4 && p[0] == "api" && p[1] == "widgets" && p[2] != "" && p[3] == "parts":
-		h = post(apiWidget{p[2]}.createPart)
-	case n == 6 && p[0] == "api" && p[1] == "widgets" && p[2] != "" && p[3] == "parts" && isId(p[4], &id) && p[5] == "update":
-		h = post(apiWidgetPart{p[2], id}.update)
-	case n == 6 && p[0] == "api" && p[1] == "widgets" && p[2] != "" && p[3] == "parts" && isId(p[4], &id) && p[5] == "delete":
-		h = post(apiWidgetPart{p[2], id}.delete)
+		h = postCreateWidgetPart
+		r.SetPathValue("slug", p[2])
+	case n == 6 && p[0] == "api" && p[1] == "widgets" && p[2] != "" && p[3] == "parts" && widgets.IsID(p[4]) && p[5] == "update":
+		h = postUpdateWidgetPart
+		r.SetPathValue("slug", p[2])
+		r.SetPathValue("id", p[4])
+	case n == 6 && p[0] == "api" && p[1] == "widgets" && p[2] != "" && p[3] == "parts" && widgets.IsID(p[4]) && p[5] == "delete":
+		h = postDeleteWidgetPart
+		r.SetPathValue("slug", p[2])
+		r.SetPathValue("id", p[4])
 	case n == 1:
-		h = get(widget{p[0]}.widget)
+		h = getWidget
+		r.SetPathValue("slug", p[0])
 	case n == 2 && p[1] == "admin":
-		h = get(widget{p[0]}.admin)
+		h = getWidgetAdmin
+		r.SetPathValue("slug", p[0])
 	case n == 2 && p[1] == "image":
-		h = post(widget{p[0]}.image)
+		h = postWidgetImage
+		r.SetPathValue("slug", p[0])
 	default:
 		http.NotFound(w, r)
 		return
@@ -47,87 +84,46 @@ func Serve(w http.ResponseWriter, r *http.Request) {
 	h.ServeHTTP(w, r)
 }
 
-func allowMethod(h http.HandlerFunc, method string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if method != r.Method {
-			w.Header().Set("Allow", method)
-			http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
+// methods is a handler that dispatches to the handler registered for
+// the request's method, with the GET handler also answering HEAD. If
+// there isn't one, it responds to OPTIONS with 204 No Content, and to
+// other methods with 405 Method Not Allowed, in both cases with an Allow
+// header listing every method allowed (OPTIONS included in the response
+// to OPTIONS).
+type methods map[string]http.HandlerFunc
+
+func (m methods) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h := m[r.Method]; h != nil {
 		h(w, r)
+		return
 	}
-}
-
-func get(h http.HandlerFunc) http.HandlerFunc {
-	return allowMethod(h, "GET")
-}
-
-func post(h http.HandlerFunc) http.HandlerFunc {
-	return allowMethod(h, "POST")
-}
-
-func isId(s string, p *int) bool {
-	id, err := strconv.Atoi(s)
-	if err != nil || id <= 0 {
-		return false
+	if r.Method == "HEAD" && m["GET"] != nil {
+		autohead.Serve(w, r, m["GET"])
+		return
 	}
-	*p = id
-	return true
-}
-
-func home(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "home\n")
-}
-
-func contact(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "contact\n")
-}
-
-func apiGetWidgets(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "apiGetWidgets\n")
-}
-
-func apiCreateWidget(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "apiCreateWidget\n")
-}
-
-type apiWidget struct {
-	slug string
-}
-
-func (h apiWidget) update(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "apiUpdateWidget %s\n", h.slug)
-}
-
-func (h apiWidget) createPart(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "apiCreateWidgetPart %s\n", h.slug)
-}
-
-type apiWidgetPart struct {
-	slug string
-	id   int
-}
-
-func (h apiWidgetPart) update(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "apiUpdateWidgetPart %s %d\n", h.slug, h.id)
-}
-
-func (h apiWidgetPart) delete(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "apiDeleteWidgetPart %s %d\n", h.slug, h.id)
-}
-
-type widget struct {
-	slug string
-}
-
-func (h widget) widget(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "widget %s\n", h.slug)
+	allow := make([]string, 0, len(m)+2)
+	for method := range m {
+		allow = append(allow, method)
+		if method == "GET" && m["HEAD"] == nil {
+			allow = append(allow, "HEAD")
+		}
+	}
+	if r.Method == "OPTIONS" {
+		allow = append(allow, "OPTIONS")
+	}
+	sort.Strings(allow)
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
 }
 
-func (h widget) admin(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "widgetAdmin %s\n", h.slug)
+func get(h http.HandlerFunc) http.Handler {
+	return methods{"GET": h}
 }
 
-func (h widget) image(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "widgetImage %s\n", h.slug)
+func post(h http.HandlerFunc) http.Handler {
+	return methods{"POST": h}
 }
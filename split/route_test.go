@@ -0,0 +1,45 @@
+package split
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/benhoyt/go-routing/internal/middleware"
+)
+
+// tag returns middleware that appends name to the X-Trace header, then
+// calls the next handler.
+func tag(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestUse(t *testing.T) {
+	t.Cleanup(func() { stack = middleware.NewStack(http.HandlerFunc(dispatch)) })
+	Use(tag("a"), tag("b"))
+	Use(tag("c"))
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"GET", "/foo", 200},
+		{"POST", "/foo", 405},
+		{"OPTIONS", "/foo", 204},
+		{"GET", "/foo/bar", 404},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		Serve(recorder, httptest.NewRequest(test.method, test.path, nil))
+		trace := strings.Join(recorder.Header()["X-Trace"], " ")
+		if recorder.Code != test.status || trace != "a b c" {
+			t.Errorf("%s %s: got %d %q, want %d \"a b c\"", test.method, test.path, recorder.Code, trace, test.status)
+		}
+	}
+}
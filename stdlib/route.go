@@ -7,86 +7,134 @@ package stdlib
 import (
 	"fmt"
 	"net/http"
-	"strconv"
+	"net/url"
+	"strings"
+
+	"github.com/benhoyt/go-routing/introspect"
+	"github.com/benhoyt/go-routing/widgets"
 )
 
+var handlers = widgets.Default
+
 var Serve http.Handler
 
 func init() {
 	r := http.NewServeMux()
-
-	r.HandleFunc("GET /{$}", home)
-	r.HandleFunc("GET /contact", contact)
-	r.HandleFunc("GET /api/widgets", apiGetWidgets)
-	r.HandleFunc("POST /api/widgets", apiCreateWidget)
-	r.HandleFunc("POST /api/widgets/{slug}", apiUpdateWidget)
-	r.HandleFunc("POST /api/widgets/{slug}/parts", apiCreateWidgetPart)
-	r.HandleFunc("POST /api/widgets/{slug}/parts/{id}/update", apiUpdateWidgetPart)
-	r.HandleFunc("POST /api/widgets/{slug}/parts/{id}/delete", apiDeleteWidgetPart)
-	r.HandleFunc("GET /{slug}", widgetGet)
-	r.HandleFunc("GET /{slug}/admin", widgetAdmin)
-	r.HandleFunc("POST /{slug}/image", widgetImage)
-
+	for _, route := range routes {
+		r.HandleFunc(route.pattern, route.handler)
+		if route.name != "" {
+			patterns[route.name] = route.pattern
+		}
+	}
 	Serve = r
 }
 
-func home(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "home\n")
-}
-
-func contact(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "contact\n")
-}
-
-func apiGetWidgets(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "apiGetWidgets\n")
+var routes = []struct {
+	name    string
+	pattern string
+	handler http.HandlerFunc
+}{
+	{"home", "GET /{$}", handlers.Home},
+	{"contact", "GET /contact", handlers.Contact},
+	{"getWidgets", "GET /api/widgets", handlers.GetWidgets},
+	{"createWidget", "POST /api/widgets", handlers.CreateWidget},
+	{"updateWidget", "POST /api/widgets/{slug}", handlers.UpdateWidget},
+	{"createWidgetPart", "POST /api/widgets/{slug}/parts", handlers.CreateWidgetPart},
+	{"updateWidgetPart", "POST /api/widgets/{slug}/parts/{id}/update", handlers.UpdateWidgetPart},
+	{"deleteWidgetPart", "POST /api/widgets/{slug}/parts/{id}/delete", handlers.DeleteWidgetPart},
+	{"widget", "GET /{slug}", handlers.Widget},
+	{"widgetAdmin", "GET /{slug}/admin", handlers.WidgetAdmin},
+	{"widgetImage", "POST /{slug}/image", handlers.WidgetImage},
 }
 
-func apiCreateWidget(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "apiCreateWidget\n")
-}
-
-func apiUpdateWidget(w http.ResponseWriter, r *http.Request) {
-	slug := r.PathValue("slug")
-	fmt.Fprintf(w, "apiUpdateWidget %s\n", slug)
-}
-
-func apiCreateWidgetPart(w http.ResponseWriter, r *http.Request) {
-	slug := r.PathValue("slug")
-	fmt.Fprintf(w, "apiCreateWidgetPart %s\n", slug)
-}
-
-func apiUpdateWidgetPart(w http.ResponseWriter, r *http.Request) {
-	slug := r.PathValue("slug")
-	id, err := strconv.Atoi(r.PathValue("id"))
-	if err != nil {
-		http.NotFound(w, r)
-		return
+var patterns = make(map[string]string) // by route name
+
+// Routes returns the routes registered with Serve, in the order they
+// were registered (ServeMux chooses the most specific pattern that
+// matches a request, so the order doesn't matter).
+func Routes() []introspect.RouteInfo {
+	var infos []introspect.RouteInfo
+	for _, route := range routes {
+		method, pattern, _ := strings.Cut(route.pattern, " ")
+		infos = append(infos, introspect.RouteInfo{
+			Method:  method,
+			Pattern: pattern,
+			Handler: introspect.HandlerName(route.handler),
+		})
 	}
-	fmt.Fprintf(w, "apiUpdateWidgetPart %s %d\n", slug, id)
+	return infos
 }
 
-func apiDeleteWidgetPart(w http.ResponseWriter, r *http.Request) {
-	slug := r.PathValue("slug")
-	id, err := strconv.Atoi(r.PathValue("id"))
-	if err != nil {
-		http.NotFound(w, r)
-		return
+// URL builds the URL path for the route with the given name, substituting
+// params, which are alternating parameter names and values, for the
+// "{name}" and "{name...}" wildcards in its pattern. Values are escaped
+// a segment at a time, so a "{name}" value may contain a slash (sent as
+// %2F, which ServeMux unescapes after matching), and a "{name...}" value
+// may span segments. It returns an error if there's no such route, or if
+// a parameter is missing or unknown, or its value wouldn't be matched:
+// "{name}" values must be non-empty and not "." or "..", and the segments
+// of a "{name...}" value must be too (apart from a trailing slash), as
+// ServeMux redirects paths that aren't clean.
+func URL(name string, params ...string) (string, error) {
+	pattern, ok := patterns[name]
+	if !ok {
+		return "", fmt.Errorf("stdlib: no route named %q", name)
 	}
-	fmt.Fprintf(w, "apiDeleteWidgetPart %s %d\n", slug, id)
-}
-
-func widgetGet(w http.ResponseWriter, r *http.Request) {
-	slug := r.PathValue("slug")
-	fmt.Fprintf(w, "widget %s\n", slug)
-}
-
-func widgetAdmin(w http.ResponseWriter, r *http.Request) {
-	slug := r.PathValue("slug")
-	fmt.Fprintf(w, "widgetAdmin %s\n", slug)
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("stdlib: route %q: odd number of params", name)
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+	used := make(map[string]bool, len(values))
+
+	_, path, _ := strings.Cut(pattern, " ")
+	var sb strings.Builder
+	for _, segment := range strings.Split(path, "/")[1:] {
+		if segment == "{$}" {
+			sb.WriteByte('/')
+			break
+		}
+		if !strings.HasPrefix(segment, "{") {
+			sb.WriteString("/" + url.PathEscape(segment))
+			continue
+		}
+		param := strings.Trim(segment, "{}")
+		param, isRest := strings.CutSuffix(param, "...")
+		value, ok := values[param]
+		if !ok {
+			return "", fmt.Errorf("stdlib: route %q: missing param %q", name, param)
+		}
+		if !isRest {
+			if !isValidSegment(value) {
+				return "", fmt.Errorf("stdlib: route %q: param %q value %q isn't a valid segment", name, param, value)
+			}
+			sb.WriteString("/" + url.PathEscape(value))
+			used[param] = true
+			continue
+		}
+		parts := strings.Split(value, "/")
+		for i, part := range parts {
+			isTrailingSlash := i > 0 && i == len(parts)-1 && part == ""
+			if value != "" && !isTrailingSlash && !isValidSegment(part) {
+				return "", fmt.Errorf("stdlib: route %q: param %q value %q isn't a clean path", name, param, value)
+			}
+			parts[i] = url.PathEscape(part)
+		}
+		sb.WriteString("/" + strings.Join(parts, "/")) // a rest wildcard is always last
+		used[param] = true
+	}
+	for i := 0; i < len(params); i += 2 {
+		if !used[params[i]] {
+			return "", fmt.Errorf("stdlib: route %q has no param %q", name, params[i])
+		}
+	}
+	return sb.String(), nil
 }
 
-func widgetImage(w http.ResponseWriter, r *http.Request) {
-	slug := r.PathValue("slug")
-	fmt.Fprintf(w, "widgetImage %s\n", slug)
+// isValidSegment reports whether s can be a path segment that ServeMux
+// will match without first redirecting to the clean path.
+func isValidSegment(s string) bool {
+	return s != "" && s != "." && s != ".."
 }
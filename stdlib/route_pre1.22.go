@@ -3,7 +3,18 @@
 package stdlib
 
 import (
+	"errors"
 	"net/http"
+
+	"github.com/benhoyt/go-routing/introspect"
 )
 
 var Serve http.Handler
+
+func Routes() []introspect.RouteInfo {
+	return nil
+}
+
+func URL(name string, params ...string) (string, error) {
+	return "", errors.New("stdlib: requires Go 1.22")
+}
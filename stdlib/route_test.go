@@ -0,0 +1,84 @@
+//go:build go1.22
+
+package stdlib
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		params []string
+		want   string
+		err    string
+	}{
+		{"home", nil, "/", ""},
+		{"getWidgets", nil, "/api/widgets", ""},
+		{"updateWidgetPart", []string{"slug", "foo", "id", "1"}, "/api/widgets/foo/parts/1/update", ""},
+		{"updateWidgetPart", []string{"id", "42", "slug", "bar-baz"}, "/api/widgets/bar-baz/parts/42/update", ""},
+		{"widget", []string{"slug", "a b"}, "/a%20b", ""},
+		{"widget", []string{"slug", "a/b"}, "/a%2Fb", ""},
+		{"nope", nil, "", `no route named "nope"`},
+		{"widget", []string{"slug"}, "", "odd number of params"},
+		{"updateWidgetPart", []string{"slug", "foo"}, "", `missing param "id"`},
+		{"widget", []string{"slug", ""}, "", `param "slug" value "" isn't a valid segment`},
+		{"widget", []string{"slug", ".."}, "", `param "slug" value ".." isn't a valid segment`},
+		{"widget", []string{"slug", "foo", "id", "1"}, "", `has no param "id"`},
+	}
+	for _, test := range tests {
+		got, err := URL(test.name, test.params...)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("URL(%q, %q): got error %v, want %q", test.name, test.params, err, test.err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("URL(%q, %q): got %q, %v, want %q", test.name, test.params, got, err, test.want)
+		}
+	}
+}
+
+// TestURLRoundTrip checks that the URL built for each named route is
+// routed back to that route by a ServeMux, with the same parameters.
+func TestURLRoundTrip(t *testing.T) {
+	var gotName, gotValue string
+	mux := http.NewServeMux()
+	for name, pattern := range map[string]string{"param": "GET /p/{v}", "rest": "GET /r/{v...}"} {
+		patterns[name] = pattern
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			gotName, gotValue = name, r.PathValue("v")
+		})
+	}
+	t.Cleanup(func() {
+		delete(patterns, "param")
+		delete(patterns, "rest")
+	})
+	for _, test := range []struct{ name, value string }{
+		{"param", "foo"},
+		{"param", "a b?#%"},
+		{"param", "a/b"},
+		{"rest", ""},
+		{"rest", "x/y/z/"},
+		{"rest", "a b/?#%"},
+	} {
+		u, err := URL(test.name, "v", test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotName, gotValue = "", ""
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", u, nil))
+		if gotName != test.name || gotValue != test.value {
+			t.Errorf("%s %q: routed to %q with value %q", test.name, u, gotName, gotValue)
+		}
+	}
+	for _, value := range []string{"a//b", "./a", "a/.."} {
+		if u, err := URL("rest", "v", value); err == nil {
+			t.Errorf("rest %q: got %q, want error", value, u)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Benchmark the routers with a weighted mix of requests
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/benhoyt/go-routing/routertest"
+)
+
+var trafficFile = flag.String("traffic", "",
+	"traffic profile file for BenchmarkTraffic (default is a built-in profile based on routertest.Spec)")
+
+// trafficRequest is a request in a traffic profile, along with its
+// weight relative to the other requests in the profile.
+type trafficRequest struct {
+	weight int
+	method string
+	path   string
+}
+
+// builtinTraffic returns a profile containing every request in
+// routertest.Spec, weighted so that most of the traffic is hits, with a
+// smaller share of 404s (including trailing slashes) and 405s.
+func builtinTraffic() []trafficRequest {
+	var profile []trafficRequest
+	for _, c := range routertest.Spec {
+		weight := 20
+		switch {
+		case c.Path != "/" && strings.HasSuffix(c.Path, "/"):
+			weight = 2
+		case c.Status == 404:
+			weight = 3
+		case c.Status == 405:
+			weight = 1
+		}
+		profile = append(profile, trafficRequest{weight, c.Method, c.Path})
+	}
+	return profile
+}
+
+// readTraffic reads a traffic profile from the named file. Each line has
+// the form "weight method path"; blank lines and lines starting with '#'
+// are ignored.
+func readTraffic(filename string) ([]trafficRequest, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var profile []trafficRequest
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected \"weight method path\"", filename, lineNum)
+		}
+		weight, err := strconv.Atoi(fields[0])
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("%s:%d: invalid weight %q", filename, lineNum, fields[0])
+		}
+		profile = append(profile, trafficRequest{weight, fields[1], fields[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(profile) == 0 {
+		return nil, fmt.Errorf("%s: no requests in traffic profile", filename)
+	}
+	return profile, nil
+}
+
+// sampleTraffic returns n requests drawn at random from profile according
+// to their weights. The sequence is deterministic, so that every router
+// sees the same requests in the same order.
+func sampleTraffic(profile []trafficRequest, n int) ([]*http.Request, error) {
+	total := 0
+	for _, t := range profile {
+		total += t.weight
+	}
+	rnd := rand.New(rand.NewSource(1))
+	requests := make([]*http.Request, n)
+	for i := range requests {
+		x := rnd.Intn(total)
+		for _, t := range profile {
+			if x < t.weight {
+				request, err := http.NewRequest(t.method, t.path, nil)
+				if err != nil {
+					return nil, err
+				}
+				requests[i] = request
+				break
+			}
+			x -= t.weight
+		}
+	}
+	return requests, nil
+}
+
+// BenchmarkTraffic replays a weighted mix of requests against each
+// router, from the file given by the -traffic flag or the built-in
+// profile, and reports its throughput in requests per second.
+func BenchmarkTraffic(b *testing.B) {
+	profile := builtinTraffic()
+	if *trafficFile != "" {
+		var err error
+		profile, err = readTraffic(*trafficFile)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	requests, err := sampleTraffic(profile, 4096)
+	if err != nil {
+		b.Fatal(err)
+	}
+	responseWriter := &noopResponseWriter{}
+
+	for _, name := range routerNames {
+		router := routers[name]
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				router.ServeHTTP(responseWriter, copyRequest(requests[i%len(requests)]))
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "req/s")
+		})
+	}
+}
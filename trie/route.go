@@ -0,0 +1,403 @@
+// Go HTTP router based on a radix tree (compressed prefix trie)
+
+package trie
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/benhoyt/go-routing/internal/autohead"
+	"github.com/benhoyt/go-routing/introspect"
+	"github.com/benhoyt/go-routing/widgets"
+)
+
+var handlers = widgets.Default
+
+var Serve = NewRouter()
+
+func init() {
+	for _, r := range routes {
+		Serve.Handle(r.method, r.pattern, r.handler).Name(r.name)
+	}
+}
+
+var routes = []struct {
+	name    string
+	method  string
+	pattern string
+	handler http.HandlerFunc
+}{
+	{"home", "GET", "/", handlers.Home},
+	{"contact", "GET", "/contact", handlers.Contact},
+	{"getWidgets", "GET", "/api/widgets", handlers.GetWidgets},
+	{"createWidget", "POST", "/api/widgets", handlers.CreateWidget},
+	{"updateWidget", "POST", "/api/widgets/:slug", handlers.UpdateWidget},
+	{"createWidgetPart", "POST", "/api/widgets/:slug/parts", handlers.CreateWidgetPart},
+	{"updateWidgetPart", "POST", "/api/widgets/:slug/parts/:id/update", handlers.UpdateWidgetPart},
+	{"deleteWidgetPart", "POST", "/api/widgets/:slug/parts/:id/delete", handlers.DeleteWidgetPart},
+	{"widget", "GET", "/:slug", handlers.Widget},
+	{"widgetAdmin", "GET", "/:slug/admin", handlers.WidgetAdmin},
+	{"widgetImage", "POST", "/:slug/image", handlers.WidgetImage},
+}
+
+// Router is an HTTP handler that looks up the request path in a radix
+// tree. Static path segments take precedence over ":name" parameters,
+// which take precedence over a trailing "*name" catch-all, regardless of
+// the order routes were registered in. The zero value is an empty router
+// ready to use.
+type Router struct {
+	root     node
+	patterns map[string]string // by route name
+}
+
+// NewRouter returns a new, empty router.
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// node is a node in the radix tree. Static nodes match their prefix
+// exactly, param nodes match a single non-empty path segment, and
+// catch-all nodes match the rest of the path.
+type node struct {
+	prefix   string                  // static text, for static nodes
+	name     string                  // parameter name, for param and catch-all nodes
+	children []*node                 // static children, each with a distinct first byte
+	param    *node                   // ":name" child, if any
+	catchAll *node                   // "*name" child, if any
+	handlers map[string]http.Handler // handlers by method, if a route ends here
+}
+
+// Handle registers handler for requests with the given method and a path
+// matching pattern. A pattern segment of the form ":name" matches any
+// single non-empty segment, and a final segment of the form "*name"
+// matches the rest of the path, slashes included. Parameter values are
+// available to the handler via r.PathValue(name). Handle panics if the
+// pattern is malformed, conflicts with an existing parameter name, or
+// is already registered for method.
+func (rt *Router) Handle(method, pattern string, handler http.Handler) *Route {
+	if !strings.HasPrefix(pattern, "/") {
+		panic(fmt.Sprintf("trie: pattern %q must start with '/'", pattern))
+	}
+	n := &rt.root
+	for p := pattern; p != ""; {
+		switch p[0] {
+		case ':':
+			var name string
+			name, p = cutSegment(p[1:])
+			n = n.paramChild(pattern, name)
+		case '*':
+			name := p[1:]
+			if strings.Contains(name, "/") {
+				panic(fmt.Sprintf("trie: catch-all must be the last segment in %q", pattern))
+			}
+			n = n.catchAllChild(pattern, name)
+			p = ""
+		default:
+			end := strings.IndexAny(p, ":*")
+			if end < 0 {
+				end = len(p)
+			} else if p[end-1] != '/' {
+				panic(fmt.Sprintf("trie: parameter must start a segment in %q", pattern))
+			}
+			n = n.staticChild(p[:end])
+			p = p[end:]
+		}
+	}
+	if n.handlers[method] != nil {
+		panic(fmt.Sprintf("trie: %s %s is already registered", method, pattern))
+	}
+	if n.handlers == nil {
+		n.handlers = make(map[string]http.Handler)
+	}
+	n.handlers[method] = handler
+	return &Route{rt, pattern}
+}
+
+// Route is a registered route, returned by Router.Handle so that it can
+// be named.
+type Route struct {
+	rt      *Router
+	pattern string
+}
+
+// Name names the route so that URLs for it can be built with
+// Router.URL. It panics if the name is already in use.
+func (r *Route) Name(name string) *Route {
+	if _, ok := r.rt.patterns[name]; ok {
+		panic(fmt.Sprintf("trie: route name %q is already in use", name))
+	}
+	if r.rt.patterns == nil {
+		r.rt.patterns = make(map[string]string)
+	}
+	r.rt.patterns[name] = r.pattern
+	return r
+}
+
+// URL builds the URL path for the route with the given name, substituting
+// params, which are alternating parameter names and values, for its
+// ":name" and "*name" segments. It returns an error if there's no such
+// route, or if a parameter is missing or unknown, or its value can't be
+// matched by its segment: ":name" values must be non-empty and not
+// contain a slash, and "*name" values must be non-empty.
+func (rt *Router) URL(name string, params ...string) (string, error) {
+	pattern, ok := rt.patterns[name]
+	if !ok {
+		return "", fmt.Errorf("trie: no route named %q", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("trie: route %q: odd number of params", name)
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+	used := make(map[string]bool, len(values))
+
+	var sb strings.Builder
+	for p := pattern; p != ""; {
+		switch p[0] {
+		case ':', '*':
+			isCatchAll := p[0] == '*'
+			var param string
+			param, p = cutSegment(p[1:]) // a catch-all is always last
+			value, ok := values[param]
+			switch {
+			case !ok:
+				return "", fmt.Errorf("trie: route %q: missing param %q", name, param)
+			case value == "":
+				return "", fmt.Errorf("trie: route %q: param %q is empty", name, param)
+			case !isCatchAll && strings.Contains(value, "/"):
+				return "", fmt.Errorf("trie: route %q: param %q value %q contains a slash", name, param, value)
+			}
+			sb.WriteString(value)
+			used[param] = true
+		default:
+			end := strings.IndexAny(p, ":*")
+			if end < 0 {
+				end = len(p)
+			}
+			sb.WriteString(p[:end])
+			p = p[end:]
+		}
+	}
+	for i := 0; i < len(params); i += 2 {
+		if !used[params[i]] {
+			return "", fmt.Errorf("trie: route %q has no param %q", name, params[i])
+		}
+	}
+	return (&url.URL{Path: sb.String()}).EscapedPath(), nil
+}
+
+// cutSegment splits p at the first slash, returning the segment before it
+// and the rest of p (including the slash).
+func cutSegment(p string) (segment, rest string) {
+	i := strings.IndexByte(p, '/')
+	if i < 0 {
+		return p, ""
+	}
+	return p[:i], p[i:]
+}
+
+// staticChild returns the descendant of n that matches the static text s,
+// creating it, and splitting existing nodes where their prefixes only
+// partially overlap s, as needed.
+func (n *node) staticChild(s string) *node {
+	for s != "" {
+		var child *node
+		for _, c := range n.children {
+			if c.prefix[0] == s[0] {
+				child = c
+				break
+			}
+		}
+		if child == nil {
+			child = &node{prefix: s}
+			n.children = append(n.children, child)
+			return child
+		}
+		i := 0
+		for i < len(s) && i < len(child.prefix) && s[i] == child.prefix[i] {
+			i++
+		}
+		if i < len(child.prefix) {
+			// Split child so that it ends where s diverges from it
+			tail := *child
+			tail.prefix = child.prefix[i:]
+			*child = node{prefix: child.prefix[:i], children: []*node{&tail}}
+		}
+		n = child
+		s = s[i:]
+	}
+	return n
+}
+
+func (n *node) paramChild(pattern, name string) *node {
+	if name == "" {
+		panic(fmt.Sprintf("trie: empty parameter name in %q", pattern))
+	}
+	if n.param == nil {
+		n.param = &node{name: name}
+	} else if n.param.name != name {
+		panic(fmt.Sprintf("trie: parameter %q in %q conflicts with existing %q", name, pattern, n.param.name))
+	}
+	return n.param
+}
+
+func (n *node) catchAllChild(pattern, name string) *node {
+	if name == "" {
+		panic(fmt.Sprintf("trie: empty catch-all name in %q", pattern))
+	}
+	if n.catchAll == nil {
+		n.catchAll = &node{name: name}
+	} else if n.catchAll.name != name {
+		panic(fmt.Sprintf("trie: catch-all %q in %q conflicts with existing %q", name, pattern, n.catchAll.name))
+	}
+	return n.catchAll
+}
+
+// Routes returns the routes registered with rt, in order of precedence
+// (see Router).
+func (rt *Router) Routes() []introspect.RouteInfo {
+	var routes []introspect.RouteInfo
+	rt.root.walk("", &routes)
+	return routes
+}
+
+// walk appends the routes in the subtree rooted at n to routes, where
+// pattern is the pattern leading up to n's prefix (for static nodes) or
+// up to and including its parameter (for param and catch-all nodes).
+func (n *node) walk(pattern string, routes *[]introspect.RouteInfo) {
+	pattern += n.prefix
+	methods := make([]string, 0, len(n.handlers))
+	for method := range n.handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		*routes = append(*routes, introspect.RouteInfo{
+			Method:  method,
+			Pattern: pattern,
+			Handler: introspect.HandlerName(n.handlers[method]),
+		})
+	}
+	for _, child := range n.children {
+		child.walk(pattern, routes)
+	}
+	if n.param != nil {
+		n.param.walk(pattern+":"+n.param.name, routes)
+	}
+	if n.catchAll != nil {
+		n.catchAll.walk(pattern+"*"+n.catchAll.name, routes)
+	}
+}
+
+// ServeHTTP dispatches the request to the handler of the highest-priority
+// route whose pattern and method match, with GET routes also answering
+// HEAD requests (unless a HEAD route is registered). If the path matches
+// but the method doesn't, it responds with 405 Method Not Allowed and an
+// Allow header listing the methods of every route matching the path.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var m match
+	if !rt.root.lookup(r.URL.Path, r.Method, nil, &m) {
+		if len(m.allow) > 0 {
+			sort.Strings(m.allow)
+			w.Header().Set("Allow", strings.Join(m.allow, ", "))
+			http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+	for _, p := range m.params {
+		r.SetPathValue(p.name, p.value)
+	}
+	if m.head {
+		autohead.Serve(w, r, m.handler)
+		return
+	}
+	m.handler.ServeHTTP(w, r)
+}
+
+type param struct {
+	name  string
+	value string
+}
+
+// match is the result of a lookup: the matched handler and its
+// parameters, or if no route matched, the methods that are allowed.
+type match struct {
+	handler http.Handler
+	head    bool // handler is a GET handler answering a HEAD request
+	params  []param
+	allow   []string
+}
+
+// lookup searches the subtree rooted at n for a route matching path and
+// method, backtracking from static to param to catch-all children. It
+// reports whether a route was found, filling in m.
+func (n *node) lookup(path, method string, params []param, m *match) bool {
+	if path == "" {
+		return n.end(method, params, m)
+	}
+	for _, child := range n.children {
+		if strings.HasPrefix(path, child.prefix) {
+			if child.lookup(path[len(child.prefix):], method, params, m) {
+				return true
+			}
+			break // no other child has the same first byte
+		}
+	}
+	if n.param != nil {
+		segment, rest := cutSegment(path)
+		if segment != "" {
+			params := append(params, param{n.param.name, segment})
+			if n.param.lookup(rest, method, params, m) {
+				return true
+			}
+		}
+	}
+	if n.catchAll != nil {
+		params := append(params, param{n.catchAll.name, path})
+		return n.catchAll.end(method, params, m)
+	}
+	return false
+}
+
+// end handles a lookup that has consumed the entire path at node n.
+func (n *node) end(method string, params []param, m *match) bool {
+	h := n.handlers[method]
+	if h == nil && method == "HEAD" {
+		h = n.handlers["GET"]
+		m.head = h != nil
+	}
+	if h != nil {
+		m.handler = h
+		m.params = params
+		return true
+	}
+	for allowed := range n.handlers {
+		m.addAllowed(allowed)
+		if allowed == "GET" {
+			m.addAllowed("HEAD")
+		}
+	}
+	return false
+}
+
+func (m *match) addAllowed(method string) {
+	if !contains(m.allow, method) {
+		m.allow = append(m.allow, method)
+	}
+}
+
+func contains(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package trie
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		params []string
+		want   string
+		err    string
+	}{
+		{"home", nil, "/", ""},
+		{"getWidgets", nil, "/api/widgets", ""},
+		{"updateWidgetPart", []string{"slug", "foo", "id", "1"}, "/api/widgets/foo/parts/1/update", ""},
+		{"updateWidgetPart", []string{"id", "42", "slug", "bar-baz"}, "/api/widgets/bar-baz/parts/42/update", ""},
+		{"widget", []string{"slug", "a b"}, "/a%20b", ""},
+		{"nope", nil, "", `no route named "nope"`},
+		{"widget", []string{"slug"}, "", "odd number of params"},
+		{"updateWidgetPart", []string{"slug", "foo"}, "", `missing param "id"`},
+		{"widget", []string{"slug", "a/b"}, "", `param "slug" value "a/b" contains a slash`},
+		{"widget", []string{"slug", ""}, "", `param "slug" is empty`},
+		{"widget", []string{"slug", "foo", "id", "1"}, "", `has no param "id"`},
+	}
+	for _, test := range tests {
+		got, err := Serve.URL(test.name, test.params...)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("URL(%q, %q): got error %v, want %q", test.name, test.params, err, test.err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("URL(%q, %q): got %q, %v, want %q", test.name, test.params, got, err, test.want)
+		}
+	}
+}
+
+// TestURLRoundTrip checks that the URL built for each named route is
+// routed back to that route, with the same parameters.
+func TestURLRoundTrip(t *testing.T) {
+	var gotName, gotValue string
+	rt := NewRouter()
+	for name, pattern := range map[string]string{"param": "/p/:v", "catchAll": "/c/*v"} {
+		rt.Handle("GET", pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotName, gotValue = name, r.PathValue("v")
+		})).Name(name)
+	}
+	for _, test := range []struct{ name, value string }{
+		{"param", "foo"},
+		{"param", "a b?#%"},
+		{"catchAll", "x/y/z"},
+		{"catchAll", "a b/?#%"},
+	} {
+		u, err := rt.URL(test.name, "v", test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", u, nil))
+		if gotName != test.name || gotValue != test.value {
+			t.Errorf("%s %q: routed to %s with value %q", test.name, u, gotName, gotValue)
+		}
+	}
+}
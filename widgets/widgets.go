@@ -0,0 +1,124 @@
+// Handlers for the widget routes, shared by all the routers
+
+package widgets
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Params gets the value of a named path parameter from a request. Each
+// router makes parameters available to handlers in its own way.
+type Params interface {
+	Param(r *http.Request, name string) string
+}
+
+// ParamsFunc adapts an ordinary function to the Params interface.
+type ParamsFunc func(r *http.Request, name string) string
+
+func (f ParamsFunc) Param(r *http.Request, name string) string {
+	return f(r, name)
+}
+
+// PathValue gets parameters with r.PathValue, for http.ServeMux and the
+// routers that set parameters with r.SetPathValue.
+var PathValue Params = ParamsFunc(func(r *http.Request, name string) string {
+	return r.PathValue(name)
+})
+
+// Handlers has a handler method for each of the widget routes, which
+// gets the "slug" and "id" path parameters using a Params.
+type Handlers struct {
+	params Params
+}
+
+// New returns a set of handlers that get path parameters using params.
+func New(params Params) *Handlers {
+	return &Handlers{params}
+}
+
+// Default is the set of handlers that get path parameters using
+// r.PathValue.
+var Default = New(PathValue)
+
+// IsID reports whether s has the form of a part ID: decimal digits only,
+// with no sign, like the [0-9]+ regex some of the routers use. Routers
+// check this while routing, and leave the range to ParseID.
+func IsID(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// ParseID parses a part ID, returning an error if it isn't one (see IsID)
+// or is out of range.
+func ParseID(s string) (int, error) {
+	if !IsID(s) {
+		return 0, fmt.Errorf("invalid ID %q", s)
+	}
+	return strconv.Atoi(s)
+}
+
+func (h *Handlers) Home(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "home\n")
+}
+
+func (h *Handlers) Contact(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "contact\n")
+}
+
+func (h *Handlers) GetWidgets(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "apiGetWidgets\n")
+}
+
+func (h *Handlers) CreateWidget(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "apiCreateWidget\n")
+}
+
+func (h *Handlers) UpdateWidget(w http.ResponseWriter, r *http.Request) {
+	slug := h.params.Param(r, "slug")
+	fmt.Fprintf(w, "apiUpdateWidget %s\n", slug)
+}
+
+func (h *Handlers) CreateWidgetPart(w http.ResponseWriter, r *http.Request) {
+	slug := h.params.Param(r, "slug")
+	fmt.Fprintf(w, "apiCreateWidgetPart %s\n", slug)
+}
+
+// UpdateWidgetPart and DeleteWidgetPart respond with 404 Not Found if the
+// part ID isn't valid, for routers that don't check it while routing.
+
+func (h *Handlers) UpdateWidgetPart(w http.ResponseWriter, r *http.Request) {
+	slug := h.params.Param(r, "slug")
+	id, err := ParseID(h.params.Param(r, "id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprintf(w, "apiUpdateWidgetPart %s %d\n", slug, id)
+}
+
+func (h *Handlers) DeleteWidgetPart(w http.ResponseWriter, r *http.Request) {
+	slug := h.params.Param(r, "slug")
+	id, err := ParseID(h.params.Param(r, "id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprintf(w, "apiDeleteWidgetPart %s %d\n", slug, id)
+}
+
+func (h *Handlers) Widget(w http.ResponseWriter, r *http.Request) {
+	slug := h.params.Param(r, "slug")
+	fmt.Fprintf(w, "widget %s\n", slug)
+}
+
+func (h *Handlers) WidgetAdmin(w http.ResponseWriter, r *http.Request) {
+	slug := h.params.Param(r, "slug")
+	fmt.Fprintf(w, "widgetAdmin %s\n", slug)
+}
+
+func (h *Handlers) WidgetImage(w http.ResponseWriter, r *http.Request) {
+	slug := h.params.Param(r, "slug")
+	fmt.Fprintf(w, "widgetImage %s\n", slug)
+}